@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+)
+
+// auxHost holds the results of the extra once-per-host requests made
+// for -soft404, -check-openredirect and -allow-methods. It's shared by
+// all of the paths probed on a host using one scheme, and each request
+// is only made the first time a path needs it.
+type auxHost struct {
+	base   string
+	client *http.Client
+	opts   probeOptions
+
+	// the baseline is only compared by its hash, and mustn't be
+	// stored or extracted from like a real result
+	baselineOpts probeOptions
+
+	baselineOnce sync.Once
+	baseline     probeResult
+
+	openRedirectOnce sync.Once
+	openRedirect     bool
+
+	allowOnce sync.Once
+	allow     string
+}
+
+func newAuxHost(base string, client *http.Client, opts probeOptions) *auxHost {
+	baselineOpts := opts.headersOnly()
+	baselineOpts.needHash = true
+
+	return &auxHost{
+		base:         base,
+		client:       client,
+		opts:         opts,
+		baselineOpts: baselineOpts,
+	}
+}
+
+// auxItem is a result waiting on its host's extra requests before it's
+// output. With -group, an item with done set marks the end of a job,
+// and is only passed on once the rest of the job's items (counted by
+// pending) have been.
+type auxItem struct {
+	probeOutput
+	host    *auxHost
+	pending *sync.WaitGroup
+}
+
+// auxQueue is an unbounded first-in first-out queue of auxItems, so
+// that the probe workers never have to wait for the aux workers to
+// catch up. Items are pushed onto in and come out of out, which is
+// closed once in has been closed and everything has come out.
+type auxQueue struct {
+	in  chan auxItem
+	out chan auxItem
+}
+
+func newAuxQueue() *auxQueue {
+	q := &auxQueue{
+		in:  make(chan auxItem),
+		out: make(chan auxItem),
+	}
+	go q.run()
+	return q
+}
+
+func (q *auxQueue) run() {
+	var pending []auxItem
+	in := q.in
+	for in != nil || len(pending) > 0 {
+		// out is only sent on when there's something to send
+		var out chan auxItem
+		var next auxItem
+		if len(pending) > 0 {
+			out, next = q.out, pending[0]
+		}
+
+		select {
+		case item, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			pending = append(pending, item)
+		case out <- next:
+			pending[0] = auxItem{}
+			pending = pending[1:]
+		}
+	}
+	close(q.out)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+)
+
+// certTrust verifies a certificate chain against the system roots,
+// independently of whether -verify is set, and returns a short
+// description of the outcome: trusted, expired, hostname-mismatch,
+// self-signed, untrusted or invalid
+func certTrust(certs []*x509.Certificate, host string) string {
+	leaf := certs[0]
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+	})
+	if err == nil {
+		return "trusted"
+	}
+
+	var invalidErr x509.CertificateInvalidError
+	var hostErr x509.HostnameError
+	var authErr x509.UnknownAuthorityError
+
+	switch {
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		return "expired"
+	case errors.As(err, &hostErr):
+		return "hostname-mismatch"
+	case errors.As(err, &authErr):
+		if isSelfSigned(leaf) {
+			return "self-signed"
+		}
+		return "untrusted"
+	default:
+		return "invalid"
+	}
+}
+
+// isSelfSigned reports whether a certificate was signed by its own key
+func isSelfSigned(c *x509.Certificate) bool {
+	if !bytes.Equal(c.RawIssuer, c.RawSubject) {
+		return false
+	}
+	return c.CheckSignatureFrom(c) == nil
+}
@@ -0,0 +1,23 @@
+package main
+
+// chromeUserAgent is the User-Agent sent with -chrome
+const chromeUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+
+// chromeEncoding is the Accept-Encoding sent with -chrome. Chrome
+// also asks for br and zstd, but they can't be decoded here.
+const chromeEncoding = "gzip, deflate"
+
+// chromeHeaders are the other headers Chrome sends when navigating to
+// a page, used with -chrome
+var chromeHeaders = [][2]string{
+	{"Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"},
+	{"Accept-Language", "en-US,en;q=0.9"},
+	{"Sec-Ch-Ua", `"Not/A)Brand";v="8", "Chromium";v="126", "Google Chrome";v="126"`},
+	{"Sec-Ch-Ua-Mobile", "?0"},
+	{"Sec-Ch-Ua-Platform", `"Windows"`},
+	{"Sec-Fetch-Dest", "document"},
+	{"Sec-Fetch-Mode", "navigate"},
+	{"Sec-Fetch-Site", "none"},
+	{"Sec-Fetch-User", "?1"},
+	{"Upgrade-Insecure-Requests", "1"},
+}
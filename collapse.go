@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/sha1"
+	"sort"
+	"strings"
+)
+
+// collapseOutputs groups live results with the same body into a
+// single result for -collapse. The first URL of each group (in
+// alphabetical order) is kept, with the URLs of the rest in its
+// cluster. Groups come out largest first, followed by any failed
+// probes, which are never grouped.
+func collapseOutputs(outputs []probeOutput) []probeOutput {
+	sort.SliceStable(outputs, func(i, j int) bool {
+		return strings.ToLower(outputs[i].url) < strings.ToLower(outputs[j].url)
+	})
+
+	var groups []probeOutput
+	var dead []probeOutput
+	index := make(map[[sha1.Size]byte]int)
+
+	for _, o := range outputs {
+		if !o.result.success {
+			dead = append(dead, o)
+			continue
+		}
+
+		if i, ok := index[o.result.bodyHash]; ok {
+			groups[i].result.cluster = append(groups[i].result.cluster, o.url)
+			continue
+		}
+		index[o.result.bodyHash] = len(groups)
+		groups = append(groups, o)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].result.cluster) > len(groups[j].result.cluster)
+	})
+
+	return append(groups, dead...)
+}
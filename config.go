@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadConfig reads a config file and applies it to any flags that
+// weren't given on the command line. The file is a small subset of
+// TOML: each line is a flag name and a value, e.g.
+//
+//	c = 50
+//	title = true
+//	A = "Mozilla/5.0"
+//	p = ["http:8080", "https:8443"]
+//
+// Arrays can only be used for flags that can be specified multiple
+// times, and can be split over several lines. Comments start with #.
+func loadConfig(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// flags given on the command line take precedence
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	seen := make(map[string]bool)
+
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+
+		start := lineNo
+		eq := strings.Index(line, "=")
+		if eq == -1 {
+			return fmt.Errorf("line %d: expected key = value", start)
+		}
+		key := strings.TrimSpace(line[:eq])
+		raw := strings.TrimSpace(line[eq+1:])
+
+		// arrays can carry on over several lines
+		for strings.HasPrefix(raw, "[") && !strings.HasSuffix(raw, "]") && sc.Scan() {
+			lineNo++
+			raw += " " + strings.TrimSpace(stripComment(sc.Text()))
+		}
+
+		fl := flag.Lookup(key)
+		if fl == nil || key == "config" {
+			return fmt.Errorf("line %d: unknown option %q", start, key)
+		}
+		if seen[key] {
+			return fmt.Errorf("line %d: %q is set more than once", start, key)
+		}
+		seen[key] = true
+
+		values, err := parseConfigValue(raw)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", start, err)
+		}
+
+		_, repeatable := fl.Value.(*probeArgs)
+		if strings.HasPrefix(raw, "[") && !repeatable {
+			return fmt.Errorf("line %d: %q can't be given a list", start, key)
+		}
+
+		if given[key] {
+			continue
+		}
+		for _, v := range values {
+			if err := flag.Set(key, v); err != nil {
+				return fmt.Errorf("line %d: invalid value for %q: %s", start, key, err)
+			}
+		}
+	}
+
+	return sc.Err()
+}
+
+// parseConfigValue parses the value part of a config line, which is a
+// single value or an array of values
+func parseConfigValue(raw string) ([]string, error) {
+	if !strings.HasPrefix(raw, "[") {
+		v, err := parseConfigScalar(raw)
+		if err != nil {
+			return nil, err
+		}
+		return []string{v}, nil
+	}
+
+	if !strings.HasSuffix(raw, "]") {
+		return nil, fmt.Errorf("unterminated list")
+	}
+
+	var values []string
+	for _, item := range splitConfigList(raw[1 : len(raw)-1]) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		v, err := parseConfigScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// parseConfigScalar parses a single value, which can be a double or
+// single quoted string or a bare word such as a number or boolean
+func parseConfigScalar(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", fmt.Errorf("missing value")
+	case strings.HasPrefix(raw, `"`):
+		v, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return v, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") || strings.Count(raw, "'") != 2 {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case strings.ContainsAny(raw, " \t\"'[],"):
+		return "", fmt.Errorf("strings must be quoted: %s", raw)
+	default:
+		return raw, nil
+	}
+}
+
+// splitConfigList splits the inside of an array on commas that aren't
+// in quotes
+func splitConfigList(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || i == 0 || s[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(items, s[start:])
+}
+
+// stripComment removes a # comment from the end of a line, ignoring
+// any # characters inside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote && (quote == '\'' || i == 0 || line[i-1] != '\\') {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns returns the columns of -csv output for the fields that
+// are turned on, in the same order as the plain text output
+func csvColumns(opts outputOptions) []string {
+	cols := []string{"url"}
+
+	add := func(on bool, names ...string) {
+		if on {
+			cols = append(cols, names...)
+		}
+	}
+	add(opts.showMethod, "method")
+	add(opts.showRequest, "request_method", "request_url")
+	add(opts.showStatus, "status")
+	add(opts.showServer, "server")
+	for _, name := range opts.headerCols {
+		cols = append(cols, "header:"+name)
+	}
+	add(opts.showTitle, "title")
+	add(opts.showProto, "proto")
+	add(opts.showALPN, "alpn")
+	add(opts.showWords, "words")
+	add(opts.showLines, "lines")
+	add(opts.showEntropy, "entropy")
+	add(opts.showLocation, "location")
+	add(opts.showRefresh, "refresh")
+	add(opts.showChain, "chain")
+	add(opts.showCertExpiry, "expiry")
+	add(opts.showCertTrust, "trust")
+	add(opts.showTiming, "dns_ms", "connect_ms", "tls_ms", "ttfb_ms")
+	add(opts.showHeaders, "header_count", "header_bytes")
+	add(opts.showTech, "tech")
+	add(opts.showAllow, "allow")
+	add(opts.showListing, "listing")
+	add(opts.showChunked, "chunked")
+	add(opts.showExtracts, "extract")
+	add(opts.showTimestamp, "time")
+	add(opts.showCluster, "cluster")
+
+	return cols
+}
+
+// csvRecord returns the values of the given columns for a result.
+// Failed probes only have their URL, label, time and error filled in.
+func csvRecord(cols []string, url string, r probeResult, opts outputOptions) []string {
+	r.title = truncateTitle(r.title, opts.titleTrunc)
+
+	record := make([]string, len(cols))
+	for i, col := range cols {
+		if !r.success && col != "url" && col != "label" && col != "time" && col != "error" {
+			continue
+		}
+
+		switch col {
+		case "dns_ms":
+			record[i] = csvMillis(r.timing.dns)
+		case "connect_ms":
+			record[i] = csvMillis(r.timing.connect)
+		case "tls_ms":
+			record[i] = csvMillis(r.timing.tls)
+		case "ttfb_ms":
+			record[i] = csvMillis(r.timing.ttfb)
+		case "request_method":
+			record[i] = r.requestMethod
+		case "request_url":
+			record[i] = r.requestURL
+		case "header_count":
+			record[i] = strconv.Itoa(r.headerCount)
+		case "header_bytes":
+			record[i] = strconv.Itoa(r.headerBytes)
+		case "cluster":
+			record[i] = strings.Join(r.cluster, " ")
+		case "loop":
+			if r.redirectLoop {
+				record[i] = "redirect-loop"
+			}
+		case "openredirect":
+			if r.openRedirect {
+				record[i] = "openredirect"
+			}
+		case "notlive":
+			if r.notLive {
+				record[i] = "not-live"
+			}
+		case "error":
+			record[i] = r.errClass
+		default:
+			if name, ok := strings.CutPrefix(col, "header:"); ok {
+				record[i] = r.headers[name]
+			} else {
+				record[i] = fieldValue(col, url, r)
+			}
+		}
+	}
+	return record
+}
+
+// csvMillis formats a duration as whole milliseconds
+func csvMillis(d time.Duration) string {
+	return strconv.FormatFloat(millis(d), 'f', 0, 64)
+}
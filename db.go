@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// dbBatchSize is how many results are inserted per transaction
+const dbBatchSize = 100
+
+// resultDB writes results to a SQLite database, batching the inserts
+// into transactions for speed
+type resultDB struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	pending int
+}
+
+// openResultDB opens (or creates) a SQLite database and makes sure
+// the results table exists
+func openResultDB(filename string) (*resultDB, error) {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS results (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		url       TEXT NOT NULL,
+		status    INTEGER,
+		server    TEXT,
+		title     TEXT,
+		timestamp TEXT NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &resultDB{db: db}, nil
+}
+
+// insert adds a result to the current batch, committing the batch
+// once it's full. Failed probes are stored with a NULL status, and the
+// timestamp is when the result was found rather than when it's
+// written, which can be much later with -sort or -group.
+func (r *resultDB) insert(url string, res probeResult) error {
+	if r.tx == nil {
+		tx, err := r.db.Begin()
+		if err != nil {
+			return err
+		}
+		r.tx = tx
+	}
+
+	var status sql.NullInt64
+	if res.success {
+		status = sql.NullInt64{Int64: int64(res.status), Valid: true}
+	}
+
+	_, err := r.tx.Exec(
+		"INSERT INTO results (url, status, server, title, timestamp) VALUES (?, ?, ?, ?, ?)",
+		url, status, res.server, res.title, res.found.Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+
+	r.pending++
+	if r.pending >= dbBatchSize {
+		return r.commit()
+	}
+	return nil
+}
+
+// commit commits the current batch, if there is one
+func (r *resultDB) commit() error {
+	if r.tx == nil {
+		return nil
+	}
+
+	err := r.tx.Commit()
+	r.tx = nil
+	r.pending = 0
+	return err
+}
+
+// Close commits any outstanding results and closes the database
+func (r *resultDB) Close() error {
+	if err := r.commit(); err != nil {
+		r.db.Close()
+		return err
+	}
+	return r.db.Close()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dialFunc is the signature of http.Transport.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newResolver returns a net.Resolver that sends DNS queries to the
+// given servers instead of the system resolver. Servers are used in
+// round-robin order, falling over to the next one if dialing fails.
+func newResolver(servers []string, timeout time.Duration) *net.Resolver {
+	var next uint32
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: timeout}
+
+			start := atomic.AddUint32(&next, 1) - 1
+			var err error
+			for i := 0; i < len(servers); i++ {
+				server := servers[(int(start)+i)%len(servers)]
+
+				var conn net.Conn
+				conn, err = d.DialContext(ctx, network, server)
+				if err == nil {
+					return conn, nil
+				}
+			}
+			return nil, err
+		},
+	}
+}
+
+// normaliseResolver adds the default DNS port to a resolver address
+// if it doesn't have one, and checks that the address is valid
+func normaliseResolver(addr string) (string, error) {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr, nil
+	}
+
+	if net.ParseIP(addr) == nil {
+		_, _, err := net.SplitHostPort(addr)
+		return "", err
+	}
+
+	return net.JoinHostPort(addr, "53"), nil
+}
+
+// parseHostMapping parses a host:ip mapping as given to -H-map
+func parseHostMapping(m string) (string, string, error) {
+	parts := strings.SplitN(m, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("expected host:ip")
+	}
+
+	ip := net.ParseIP(strings.Trim(parts[1], "[]"))
+	if ip == nil {
+		return "", "", fmt.Errorf("invalid IP address %q", parts[1])
+	}
+
+	return strings.ToLower(parts[0]), ip.String(), nil
+}
+
+// mapHosts wraps a dial function so that connections to any of the
+// hosts in the mapping go to the mapped IP instead. Only the address
+// dialed changes, so the Host header and SNI still use the original name.
+func mapHosts(dial dialFunc, mapping map[string]string) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err == nil {
+			if ip, ok := mapping[strings.ToLower(host)]; ok {
+				addr = net.JoinHostPort(ip, port)
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// dnsCacheTTL is how long lookups are cached for with -dns-cache
+const dnsCacheTTL = 5 * time.Minute
+
+// dnsCacheEntry is the result of looking up a host. ready is closed
+// once the lookup has finished, so that concurrent dials of the same
+// host wait for a single lookup.
+type dnsCacheEntry struct {
+	ready   chan struct{}
+	ips     []string
+	err     error
+	expires time.Time
+}
+
+// dnsCache shares the results of looking up each hostname between
+// every dial to that host. Names that don't exist are cached too, but
+// other errors aren't, so temporary failures are retried.
+type dnsCache struct {
+	resolver *net.Resolver
+
+	// ttl is how long results are kept for, where zero means for
+	// the rest of the run
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dnsCacheEntry
+}
+
+func newDNSCache(resolver *net.Resolver, ttl time.Duration) *dnsCache {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &dnsCache{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]*dnsCacheEntry),
+	}
+}
+
+// lookup returns the addresses of a host, looking it up if it isn't
+// already cached or being looked up
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	host = strings.ToLower(host)
+
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	if ok && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+		c.mu.Unlock()
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		// the lookup being waited for may have been given up on by
+		// whoever started it, in which case we try again ourselves
+		if errors.Is(e.err, context.Canceled) || errors.Is(e.err, context.DeadlineExceeded) {
+			return c.lookup(ctx, host)
+		}
+		return e.ips, e.err
+	}
+
+	e = &dnsCacheEntry{ready: make(chan struct{})}
+	c.entries[host] = e
+	c.mu.Unlock()
+
+	ips, err := c.resolver.LookupHost(ctx, host)
+
+	c.mu.Lock()
+	e.ips, e.err = ips, err
+	var dnsErr *net.DNSError
+	if err == nil || (errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		if c.ttl > 0 {
+			e.expires = time.Now().Add(c.ttl)
+		}
+	} else if c.entries[host] == e {
+		// forget the failure so the next dial tries again
+		delete(c.entries, host)
+	}
+	c.mu.Unlock()
+	close(e.ready)
+
+	return ips, err
+}
+
+// wrap returns a dial function that connects to the cached addresses
+// of a host, trying each in turn until one connects
+func (c *dnsCache) wrap(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, addr)
+		}
+
+		ips, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range ips {
+			var conn net.Conn
+			conn, err = dial(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
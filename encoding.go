@@ -0,0 +1,46 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// encodingToken matches a single coding in an Accept-Encoding header,
+// with an optional quality value (e.g. "gzip" or "br;q=0.5")
+var encodingToken = regexp.MustCompile(`^[A-Za-z0-9*_-]+(\s*;\s*q=[0-9.]+)?$`)
+
+// validateAcceptEncoding checks that a -accept-encoding value looks
+// like a comma separated list of codings
+func validateAcceptEncoding(val string) error {
+	for _, coding := range strings.Split(val, ",") {
+		if !encodingToken.MatchString(strings.TrimSpace(coding)) {
+			return fmt.Errorf("invalid coding %q", strings.TrimSpace(coding))
+		}
+	}
+	return nil
+}
+
+// decodeBody returns a reader for the decompressed body of resp. The
+// transport only decompresses responses itself when it picks the
+// Accept-Encoding header, so with -accept-encoding gzip and deflate
+// responses have to be handled here. Other encodings are returned as
+// they are.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	if resp.Uncompressed {
+		return resp.Body, nil
+	}
+
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		return zlib.NewReader(resp.Body)
+	default:
+		return resp.Body, nil
+	}
+}
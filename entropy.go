@@ -0,0 +1,29 @@
+package main
+
+import "math"
+
+// shannonEntropy returns the Shannon entropy of b in bits per byte,
+// from 0 for a single repeated byte up to 8 for uniformly random
+// data. Text tends to come out around 4 to 5, while compressed or
+// encrypted content is close to 8.
+func shannonEntropy(b []byte) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+
+	var entropy float64
+	n := float64(len(b))
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
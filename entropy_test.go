@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+
+	tests := []struct {
+		name string
+		in   []byte
+		want float64
+	}{
+		{"empty", nil, 0},
+		{"single byte", []byte("a"), 0},
+		{"repeated byte", bytes.Repeat([]byte("a"), 1000), 0},
+		{"two bytes", []byte("abababab"), 1},
+		{"four bytes", []byte("abcdabcdabcd"), 2},
+		{"all 256 bytes", all, 8},
+		{"all 256 bytes repeated", bytes.Repeat(all, 4), 8},
+	}
+
+	for _, tt := range tests {
+		if got := shannonEntropy(tt.in); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: shannonEntropy() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// resultFilter decides which live results are output. Filtered
+// results still count as live, so they don't change whether the HTTP
+// fallback is tried.
+type resultFilter struct {
+	// titleMatch, if set, must match the title; titleFilter, if
+	// set, must not
+	titleMatch  *regexp.Regexp
+	titleFilter *regexp.Regexp
+
+	// serverMatch, if set, must match the Server header
+	serverMatch *regexp.Regexp
+
+	// headerMatch, if set, must match one of the values of the
+	// headerName response header
+	headerName  string
+	headerMatch *regexp.Regexp
+
+	// maxDuration, if non-zero, is the slowest response allowed
+	maxDuration time.Duration
+}
+
+// allow reports whether a result passes all of the filters
+func (f resultFilter) allow(r probeResult) bool {
+	if f.titleMatch != nil && !f.titleMatch.MatchString(r.title) {
+		return false
+	}
+	if f.titleFilter != nil && f.titleFilter.MatchString(r.title) {
+		return false
+	}
+	if f.serverMatch != nil && !f.serverMatch.MatchString(r.server) {
+		return false
+	}
+	if f.headerMatch != nil && !matchesAny(f.headerMatch, r.header) {
+		return false
+	}
+	if f.maxDuration > 0 && r.duration > f.maxDuration {
+		return false
+	}
+	return true
+}
+
+// matchesAny reports whether re matches any of the values
+func matchesAny(re *regexp.Regexp, values []string) bool {
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHeaderMatch splits a -header-match value such as
+// "Location: /login" into the header name and the regex its value
+// must match
+func parseHeaderMatch(s string) (string, *regexp.Regexp, error) {
+	name, pattern, ok := strings.Cut(s, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", nil, fmt.Errorf("expected Name: regex, got %q", s)
+	}
+
+	re, err := regexp.Compile(strings.TrimLeft(pattern, " "))
+	if err != nil {
+		return "", nil, err
+	}
+	return http.CanonicalHeaderKey(name), re, nil
+}
+
+// statusCodes is a set of status code ranges, as given to -live-codes.
+// An empty set contains every status.
+type statusCodes [][2]int
+
+// contains reports whether a status is in the set
+func (c statusCodes) contains(status int) bool {
+	if len(c) == 0 {
+		return true
+	}
+	for _, r := range c {
+		if status >= r[0] && status <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusCodes parses a comma-separated list of status codes and
+// low-high ranges, such as "200-399,401,403"
+func parseStatusCodes(s string) (statusCodes, error) {
+	var codes statusCodes
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lowStr, highStr := part, part
+		if i := strings.Index(part, "-"); i != -1 {
+			lowStr, highStr = part[:i], part[i+1:]
+		}
+
+		low, err := parseStatusCode(lowStr)
+		if err != nil {
+			return nil, err
+		}
+		high, err := parseStatusCode(highStr)
+		if err != nil {
+			return nil, err
+		}
+		if low > high {
+			return nil, fmt.Errorf("status range %d-%d is backwards", low, high)
+		}
+
+		codes = append(codes, [2]int{low, high})
+	}
+	return codes, nil
+}
+
+// parseStatusCode parses a single three digit status code
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 100 || code > 999 {
+		return 0, fmt.Errorf("invalid status code %q", s)
+	}
+	return code, nil
+}
+
+// needTitle reports whether any of the filters use the title
+func (f resultFilter) needTitle() bool {
+	return f.titleMatch != nil || f.titleFilter != nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatPart is one piece of a parsed -format string: either literal
+// text or the name of a field to substitute
+type formatPart struct {
+	literal string
+	field   string
+}
+
+// outputFormat is a parsed -format string such as "{url} [{status}]"
+type outputFormat []formatPart
+
+// formatFields lists the placeholders that can be used in -format
+var formatFields = map[string]bool{
+	"url":      true,
+	"status":   true,
+	"method":   true,
+	"request":  true,
+	"server":   true,
+	"title":    true,
+	"proto":    true,
+	"alpn":     true,
+	"words":    true,
+	"lines":    true,
+	"entropy":  true,
+	"ip":       true,
+	"location": true,
+	"refresh":  true,
+	"upgrade":  true,
+	"chain":    true,
+	"expiry":   true,
+	"trust":    true,
+	"tech":     true,
+	"soft404":  true,
+	"listing":  true,
+	"allow":    true,
+	"chunked":  true,
+	"extract":  true,
+	"label":    true,
+	"time":     true,
+}
+
+// parseFormat parses a format string containing {field} placeholders,
+// returning an error for unknown fields or unterminated placeholders
+func parseFormat(format string) (outputFormat, error) {
+	var parts outputFormat
+
+	for format != "" {
+		start := strings.Index(format, "{")
+		if start == -1 {
+			parts = append(parts, formatPart{literal: format})
+			break
+		}
+
+		if start > 0 {
+			parts = append(parts, formatPart{literal: format[:start]})
+		}
+
+		end := strings.Index(format[start:], "}")
+		if end == -1 {
+			return nil, fmt.Errorf("unterminated placeholder in format: %s", format[start:])
+		}
+
+		field := format[start+1 : start+end]
+		if !formatFields[field] {
+			return nil, fmt.Errorf("unknown format field: {%s}", field)
+		}
+		parts = append(parts, formatPart{field: field})
+
+		format = format[start+end+1:]
+	}
+
+	return parts, nil
+}
+
+// uses reports whether the format includes the named field
+func (f outputFormat) uses(field string) bool {
+	for _, p := range f {
+		if p.field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// render substitutes the fields of a result into the format. Fields
+// with no value are rendered as "-".
+func (f outputFormat) render(url string, r probeResult) string {
+	var b strings.Builder
+
+	for _, p := range f {
+		if p.field == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+
+		val := fieldValue(p.field, url, r)
+		if val == "" {
+			val = "-"
+		}
+		b.WriteString(val)
+	}
+
+	return b.String()
+}
+
+// fieldValue returns the value of one of the formatFields for a
+// result, or an empty string if it doesn't have one
+func fieldValue(field, url string, r probeResult) string {
+	switch field {
+	case "url":
+		return url
+	case "status":
+		if r.status != 0 {
+			return strconv.Itoa(r.status)
+		}
+	case "method":
+		return r.method
+	case "request":
+		if r.requestURL != "" {
+			return r.requestMethod + " " + r.requestURL
+		}
+	case "server":
+		return r.server
+	case "title":
+		return r.title
+	case "proto":
+		return r.proto
+	case "alpn":
+		return r.alpn
+	case "words":
+		return strconv.Itoa(r.words)
+	case "lines":
+		return strconv.Itoa(r.lines)
+	case "entropy":
+		return strconv.FormatFloat(r.entropy, 'f', 2, 64)
+	case "ip":
+		return r.ip
+	case "location":
+		return r.location
+	case "refresh":
+		return r.refresh
+	case "upgrade":
+		if r.upgrade {
+			return "http->https"
+		}
+	case "chain":
+		if len(r.chain) > 1 {
+			return strings.Join(r.chain, " -> ")
+		}
+	case "expiry":
+		return certExpiry(r)
+	case "trust":
+		return r.certTrust
+	case "tech":
+		return strings.Join(r.tech, ",")
+	case "extract":
+		vals := make([]string, len(r.extracted))
+		for i, e := range r.extracted {
+			vals[i] = e
+			if e == "" {
+				vals[i] = "-"
+			}
+		}
+		return strings.Join(vals, ",")
+	case "label":
+		return r.label
+	case "time":
+		return r.found.Format(time.RFC3339)
+	case "allow":
+		return r.allow
+	case "chunked":
+		if r.chunked {
+			return "chunked"
+		}
+	case "listing":
+		if r.dirListing {
+			return "listing"
+		}
+	case "soft404":
+		if r.soft404 {
+			return "soft-404"
+		}
+	}
+	return ""
+}
+
+// jsonResult is the structure of each line of -json output
+type jsonResult struct {
+	URL      string   `json:"url"`
+	Live     bool     `json:"live"`
+	Error    string   `json:"error,omitempty"`
+	ErrClass string   `json:"error_class,omitempty"`
+	Method   string   `json:"method,omitempty"`
+	Status   int      `json:"status,omitempty"`
+	Server   string   `json:"server,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	TitleLen int      `json:"title_length,omitempty"`
+	Proto    string   `json:"proto,omitempty"`
+	ALPN     string   `json:"alpn,omitempty"`
+	Words    int      `json:"words,omitempty"`
+	Lines    int      `json:"lines,omitempty"`
+	Entropy  *float64 `json:"entropy,omitempty"`
+	IP       string   `json:"ip,omitempty"`
+	Location string   `json:"location,omitempty"`
+	Refresh  string   `json:"refresh,omitempty"`
+	Upgrade  bool     `json:"upgrade,omitempty"`
+	Chain    []string `json:"chain,omitempty"`
+	Loop     bool     `json:"redirect_loop,omitempty"`
+
+	RequestMethod string `json:"request_method"`
+	RequestURL    string `json:"request_url"`
+
+	CertExpiry *time.Time `json:"cert_expiry,omitempty"`
+	CertTrust  string     `json:"cert_trust,omitempty"`
+
+	HeaderCount int `json:"header_count,omitempty"`
+	HeaderBytes int `json:"header_bytes,omitempty"`
+
+	Headers map[string]string `json:"headers,omitempty"`
+
+	Tech    []string `json:"tech,omitempty"`
+	Soft404 bool     `json:"soft_404,omitempty"`
+	Listing bool     `json:"dir_listing,omitempty"`
+	Allow   string   `json:"allow,omitempty"`
+	Chunked bool     `json:"chunked,omitempty"`
+	Redir   bool     `json:"open_redirect,omitempty"`
+	Extract []string `json:"extract,omitempty"`
+
+	Label   string     `json:"label,omitempty"`
+	Time    *time.Time `json:"time,omitempty"`
+	Cluster []string   `json:"cluster,omitempty"`
+
+	Timing *jsonTiming `json:"timing,omitempty"`
+}
+
+// jsonTiming is the -timing breakdown in milliseconds
+type jsonTiming struct {
+	DNS     float64 `json:"dns_ms"`
+	Connect float64 `json:"connect_ms"`
+	TLS     float64 `json:"tls_ms"`
+	TTFB    float64 `json:"ttfb_ms"`
+}
+
+// millis converts a duration to fractional milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func newJSONResult(url string, r probeResult) jsonResult {
+	j := jsonResult{
+		URL:      url,
+		Live:     r.success && !r.notLive,
+		ErrClass: r.errClass,
+		Method:   r.method,
+		Status:   r.status,
+		Server:   r.server,
+		Title:    r.title,
+		Proto:    r.proto,
+		ALPN:     r.alpn,
+		Words:    r.words,
+		Lines:    r.lines,
+		IP:       r.ip,
+		Location: r.location,
+		Refresh:  r.refresh,
+		Upgrade:  r.upgrade,
+		Loop:     r.redirectLoop,
+
+		RequestMethod: r.requestMethod,
+		RequestURL:    r.requestURL,
+
+		CertTrust: r.certTrust,
+
+		HeaderCount: r.headerCount,
+		HeaderBytes: r.headerBytes,
+
+		Headers: r.headers,
+
+		Tech:    r.tech,
+		Soft404: r.soft404,
+		Listing: r.dirListing,
+		Allow:   r.allow,
+		Chunked: r.chunked,
+		Redir:   r.openRedirect,
+		Extract: r.extracted,
+		Label:   r.label,
+		Cluster: r.cluster,
+	}
+
+	if r.err != nil {
+		j.Error = r.err.Error()
+	}
+
+	if len(r.chain) > 1 {
+		j.Chain = r.chain
+	}
+
+	if len(r.certs) > 0 {
+		j.CertExpiry = &r.certs[0].NotAfter
+	}
+
+	if r.timing != (probeTiming{}) {
+		j.Timing = &jsonTiming{
+			DNS:     millis(r.timing.dns),
+			Connect: millis(r.timing.connect),
+			TLS:     millis(r.timing.tls),
+			TTFB:    millis(r.timing.ttfb),
+		}
+	}
+
+	return j
+}
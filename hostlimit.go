@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// hostLimiter limits the number of requests in flight to each host.
+// Hosts are only tracked while they have requests waiting or in
+// flight, so it doesn't grow with the size of the input.
+type hostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	hosts map[string]*hostSlot
+}
+
+// hostSlot is the semaphore for a single host, along with the number
+// of requests holding or waiting for it
+type hostSlot struct {
+	sem   chan struct{}
+	users int
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{
+		limit: limit,
+		hosts: make(map[string]*hostSlot),
+	}
+}
+
+// acquire waits until a request can be made to host, returning an
+// error if ctx is cancelled first. Every successful acquire must be
+// followed by a release.
+func (l *hostLimiter) acquire(ctx context.Context, host string) error {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlot{sem: make(chan struct{}, l.limit)}
+		l.hosts[host] = slot
+	}
+	slot.users++
+	l.mu.Unlock()
+
+	select {
+	case slot.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		l.done(host, slot)
+		return ctx.Err()
+	}
+}
+
+// release frees up the place taken by a call to acquire
+func (l *hostLimiter) release(host string) {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	slot := l.hosts[host]
+	l.mu.Unlock()
+
+	<-slot.sem
+	l.done(host, slot)
+}
+
+// done removes a user from a host's slot, forgetting the host once
+// nothing is using it
+func (l *hostLimiter) done(host string, slot *hostSlot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot.users--
+	if slot.users == 0 {
+		delete(l.hosts, host)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+)
+
+// http10Transport is an http.RoundTripper that sends HTTP/1.0
+// requests. net/http always writes an HTTP/1.1 request line whatever
+// the request's Proto is set to, so requests are written and responses
+// read here over connections from dial.
+type http10Transport struct {
+	dial      dialFunc
+	tlsConfig *tls.Config
+}
+
+func (t http10Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// the dialer reports DNS and connect events itself, but the rest
+	// of the trace has to be called from here
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace == nil {
+		trace = &httptrace.ClientTrace{}
+	}
+
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	conn, err := t.dial(ctx, "tcp", net.JoinHostPort(req.URL.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+
+	// closing the connection unblocks any reads or writes when the
+	// request is cancelled or times out
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	fail := func(err error) (*http.Response, error) {
+		stop()
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	var state *tls.ConnectionState
+	if req.URL.Scheme == "https" {
+		cfg := t.tlsConfig.Clone()
+		if cfg.ServerName == "" {
+			cfg.ServerName = req.URL.Hostname()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+		err := tlsConn.HandshakeContext(ctx)
+		cs := tlsConn.ConnectionState()
+		if trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(cs, err)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		state = &cs
+		conn = tlsConn
+	}
+
+	if trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn})
+	}
+
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		return fail(err)
+	}
+
+	// swap the version on the end of the request line
+	raw := buf.Bytes()
+	end := bytes.Index(raw, []byte("\r\n"))
+	if end == -1 || !bytes.HasSuffix(raw[:end], []byte("HTTP/1.1")) {
+		return fail(errMalformedRequest)
+	}
+	copy(raw[end-len("1.1"):end], "1.0")
+
+	_, err = conn.Write(raw)
+	if trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	br := bufio.NewReader(conn)
+	if _, err := br.Peek(1); err != nil {
+		return fail(err)
+	}
+	if trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return fail(err)
+	}
+	resp.TLS = state
+	resp.Body = &connBody{ReadCloser: resp.Body, conn: conn, stop: stop}
+
+	return resp, nil
+}
+
+// errMalformedRequest is returned if a request couldn't be rewritten
+// as HTTP/1.0
+var errMalformedRequest = errors.New("malformed request line")
+
+// connBody closes the underlying connection along with a response
+// body
+type connBody struct {
+	io.ReadCloser
+	conn net.Conn
+	stop func() bool
+}
+
+func (b *connBody) Close() error {
+	b.stop()
+	b.ReadCloser.Close()
+	return b.conn.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// splitTarget splits an input line into its host and port (which may
+// be empty). IPv6 addresses can be given with or without brackets,
+// but must be bracketed if a port is included: a bare address such as
+// 2001:db8::1:8080 is treated as an address with no port.
+func splitTarget(target string) (string, string) {
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		return host, port
+	}
+	return strings.Trim(target, "[]"), ""
+}
+
+// joinTarget is the inverse of splitTarget, bracketing IPv6
+// addresses so that the result can be used in a URL
+func joinTarget(host, port string) string {
+	if port == "" {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// inputHostname returns the hostname part of an input line, which
+// may or may not include a port
+func inputHostname(target string) string {
+	host, _ := splitTarget(target)
+	return host
+}
+
+// splitTimeout removes a per-line timeout from the end of an input
+// line, e.g. example.com|5000. The timeout is in milliseconds, and is
+// zero if the line doesn't have one.
+func splitTimeout(line string) (string, time.Duration) {
+	i := strings.LastIndex(line, "|")
+	if i == -1 {
+		return line, 0
+	}
+
+	ms, err := strconv.Atoi(line[i+1:])
+	if err != nil || ms <= 0 {
+		return line, 0
+	}
+	return line[:i], time.Duration(ms) * time.Millisecond
+}
+
+// isBlankOrComment reports whether a trimmed input line should be
+// skipped because it's empty or starts with a #
+func isBlankOrComment(line string) bool {
+	return line == "" || strings.HasPrefix(line, "#")
+}
+
+// stripDefaultPort removes the port from a target if it's the default
+// for the scheme, so that URLs come out in their canonical form
+func stripDefaultPort(scheme, target string) string {
+	host, port := splitTarget(target)
+	if (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		return joinTarget(host, "")
+	}
+	return target
+}
@@ -0,0 +1,78 @@
+package main
+
+import "testing"
+
+func TestSplitTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		host   string
+		port   string
+	}{
+		{"example.com", "example.com", ""},
+		{"example.com:8080", "example.com", "8080"},
+		{"192.0.2.1", "192.0.2.1", ""},
+		{"192.0.2.1:8443", "192.0.2.1", "8443"},
+		{"2001:db8::1", "2001:db8::1", ""},
+		{"[2001:db8::1]", "2001:db8::1", ""},
+		{"[2001:db8::1]:8080", "2001:db8::1", "8080"},
+		{"::1", "::1", ""},
+		{"[::1]:443", "::1", "443"},
+
+		// without brackets the last group is part of the address
+		{"2001:db8::1:8080", "2001:db8::1:8080", ""},
+	}
+
+	for _, tt := range tests {
+		host, port := splitTarget(tt.target)
+		if host != tt.host || port != tt.port {
+			t.Errorf("splitTarget(%q) = %q, %q, want %q, %q", tt.target, host, port, tt.host, tt.port)
+		}
+	}
+}
+
+func TestJoinTarget(t *testing.T) {
+	tests := []struct {
+		host string
+		port string
+		want string
+	}{
+		{"example.com", "", "example.com"},
+		{"example.com", "8080", "example.com:8080"},
+		{"192.0.2.1", "8443", "192.0.2.1:8443"},
+		{"2001:db8::1", "", "[2001:db8::1]"},
+		{"2001:db8::1", "8080", "[2001:db8::1]:8080"},
+		{"::1", "443", "[::1]:443"},
+	}
+
+	for _, tt := range tests {
+		if got := joinTarget(tt.host, tt.port); got != tt.want {
+			t.Errorf("joinTarget(%q, %q) = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestStripDefaultPort(t *testing.T) {
+	tests := []struct {
+		scheme string
+		target string
+		want   string
+	}{
+		{"https", "example.com:443", "example.com"},
+		{"https", "example.com:8443", "example.com:8443"},
+		{"https", "example.com:80", "example.com:80"},
+		{"https", "example.com", "example.com"},
+		{"https", "[2001:db8::1]:443", "[2001:db8::1]"},
+		{"http", "example.com:80", "example.com"},
+		{"http", "example.com:8080", "example.com:8080"},
+		{"http", "example.com:443", "example.com:443"},
+		{"http", "example.com", "example.com"},
+		{"http", "[2001:db8::1]:80", "[2001:db8::1]"},
+		{"http", "[2001:db8::1]:8080", "[2001:db8::1]:8080"},
+	}
+
+	for _, tt := range tests {
+		if got := stripDefaultPort(tt.scheme, tt.target); got != tt.want {
+			t.Errorf("stripDefaultPort(%q, %q) = %q, want %q", tt.scheme, tt.target, got, tt.want)
+		}
+	}
+}
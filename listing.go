@@ -0,0 +1,29 @@
+package main
+
+import "regexp"
+
+// listingSignatures match the start of directory listing pages from
+// common servers
+var listingSignatures = []*regexp.Regexp{
+	// Apache, nginx and lighttpd
+	regexp.MustCompile(`(?i)<(title|h1)>\s*Index of /`),
+
+	// IIS
+	regexp.MustCompile(`(?i)\[To Parent Directory\]`),
+
+	// Tomcat
+	regexp.MustCompile(`(?i)<title>\s*Directory Listing For /`),
+
+	// Python's http.server
+	regexp.MustCompile(`(?i)<title>\s*Directory listing for /`),
+}
+
+// isDirListing reports whether body looks like a directory listing
+func isDirListing(body []byte) bool {
+	for _, sig := range listingSignatures {
+		if sig.Match(body) {
+			return true
+		}
+	}
+	return false
+}
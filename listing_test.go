@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestIsDirListing(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"apache", "<html>\n<head>\n<title>Index of /files</title>\n</head>", true},
+		{"nginx", "<html>\r\n<head><title>Index of /</title></head>\r\n<body>\r\n<h1>Index of /</h1>", true},
+		{"lighttpd heading", "<h1>Index of /pub/</h1>", true},
+		{"iis", "<pre><A HREF=\"/\">[To Parent Directory]</A><br><br>", true},
+		{"tomcat", "<html><head><title>Directory Listing For /docs</title>", true},
+		{"python", "<title>Directory listing for /</title>", true},
+		{"case", "<TITLE>index of /</TITLE>", true},
+		{"empty", "", false},
+		{"normal page", "<html><head><title>Welcome</title></head></html>", false},
+		{"mentioned in text", "<p>See the Index of /docs for more</p>", false},
+	}
+
+	for _, tt := range tests {
+		if got := isDirListing([]byte(tt.body)); got != tt.want {
+			t.Errorf("%s: isDirListing() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
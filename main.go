@@ -2,19 +2,33 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha1"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/net/proxy"
 	"golang.org/x/time/rate"
@@ -31,297 +45,2574 @@ func (p probeArgs) String() string {
 	return strings.Join(p, ",")
 }
 
+// maxRedirects is the most redirects that will be followed with -chain
+const maxRedirects = 10
+
+// keepAliveDrain is the most of an unread body that's discarded so
+// the connection can be reused with -keep-alive
+const keepAliveDrain = 64 << 10
+
+// defaultMaxBody is the most of a body that's read for anything that
+// wants all of it (word counts, -entropy, -extract and so on) when
+// there's no -max-body
+const defaultMaxBody = 8 << 20
+
+// fdRetries is how many times a probe that failed because there were
+// no file descriptors left is retried, starting after fdBackoff and
+// doubling each time
+const (
+	fdRetries = 5
+	fdBackoff = 250 * time.Millisecond
+)
+
+// tlsVersions maps the values accepted by -min-tls to their
+// crypto/tls constants
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
 func main() {
 
+	// config file
+	var configFile string
+	flag.StringVar(&configFile, "config", "", "load options from this config file (command line flags take precedence)")
+
 	// concurrency flag
 	var concurrency int
-	flag.IntVar(&concurrency, "c", 20, "set the concurrency level (split equally between HTTPS and HTTP requests)")
+	flag.IntVar(&concurrency, "c", 20, "set the concurrency level")
+
+	var hostConcurrency int
+	flag.IntVar(&hostConcurrency, "host-concurrency", 0, "maximum number of requests in flight to a single host (0 = no limit)")
+
+	var auxConcurrency int
+	flag.IntVar(&auxConcurrency, "aux-concurrency", 0, "make extra requests, such as -soft404 baselines, with a separate pool of this many workers (0 = use the probe workers)")
 
 	// probe flags
 	var probes probeArgs
-	flag.Var(&probes, "p", "add additional probe (e.g. -p proto:port or -p <small|large|xlarge>)")
+	flag.Var(&probes, "p", "add additional probe (e.g. -p proto:port, -p proto:low-high or -p <small|large|xlarge>)")
+
+	// file of additional probes
+	var portsFile string
+	flag.StringVar(&portsFile, "ports-file", "", "file of additional ports to probe, one per line (port, proto:port or anything -p accepts)")
+
+	// paths to probe on each host
+	var paths probeArgs
+	flag.Var(&paths, "path", "path to probe on each host (can be specified multiple times)")
+
+	// input files
+	var inputFiles probeArgs
+	flag.Var(&inputFiles, "l", "read hosts from this file instead of stdin (can be specified multiple times, - for stdin)")
+
+	// input label separator
+	var tagSep string
+	flag.StringVar(&tagSep, "tag-sep", "", "split input lines on this separator, echoing everything after the host as a label")
+
+	// keep the case of input lines
+	var noLower bool
+	flag.BoolVar(&noLower, "no-lower", false, "don't lowercase input lines")
+
+	// skip default probes flag
+	var skipDefault bool
+	flag.BoolVar(&skipDefault, "s", false, "skip the default probes (http:80 and https:443)")
+
+	// timeout flag
+	var to int
+	flag.IntVar(&to, "t", 10000, "timeout (milliseconds)")
+
+	var connectTo int
+	flag.IntVar(&connectTo, "connect-timeout", 0, "timeout for connecting (milliseconds, defaults to -t)")
+
+	var readTo int
+	flag.IntVar(&readTo, "read-timeout", 0, "separate timeout for reading the response body (milliseconds)")
+
+	// prefer https
+	var preferHTTPS bool
+	flag.BoolVar(&preferHTTPS, "prefer-https", false, "only try plain HTTP if HTTPS fails")
+
+	// probe HTTPS and HTTP at the same time
+	var bothSchemes bool
+	flag.BoolVar(&bothSchemes, "both", false, "probe HTTPS and HTTP for each host at the same time instead of one after the other")
+
+	// only probe one scheme
+	var httpsOnly bool
+	flag.BoolVar(&httpsOnly, "https-only", false, "only probe HTTPS, never falling back to HTTP")
+
+	var httpOnly bool
+	flag.BoolVar(&httpOnly, "http-only", false, "only probe plain HTTP, including on -p https ports")
+
+	// don't fall back to HTTP on closed ports
+	var skipRefused bool
+	flag.BoolVar(&skipRefused, "skip-refused", false, "don't try HTTP on a port where the HTTPS connection was refused")
+
+	// statuses that count as live
+	var liveCodesFlag string
+	flag.StringVar(&liveCodesFlag, "live-codes", "", "only count responses with these statuses as live, e.g. 200-399,401 (default any)")
+
+	// HTTP method to use
+	var method string
+	flag.StringVar(&method, "method", "GET", "HTTP method to use")
+
+	// methods to fall back through
+	var methodList string
+	flag.StringVar(&methodList, "methods", "", "comma separated HTTP methods to try in turn until one isn't rejected with a 405 (overrides -method)")
+
+	// HTTP User-Agent to use
+	var userAgent string
+	flag.StringVar(&userAgent, "A", "httprobe", "HTTP User-Agent to use")
+
+	// browser-like headers
+	var chrome bool
+	flag.BoolVar(&chrome, "chrome", false, "send the headers Chrome would send, including its User-Agent")
+
+	// raw HTTP request to send to every host
+	var requestFile string
+	flag.StringVar(&requestFile, "request-file", "", "raw HTTP request to send to each host instead of the usual GET (the Host header is replaced)")
+
+	// file of User-Agents to pick from at random
+	var userAgentFile string
+	flag.StringVar(&userAgentFile, "A-file", "", "file of HTTP User-Agents to pick from at random for each request (overrides -A)")
+
+	// User-Agents for just one scheme
+	var userAgentHTTP string
+	flag.StringVar(&userAgentHTTP, "A-http", "", "HTTP User-Agent to use for plain HTTP probes (overrides -A and -A-file)")
+
+	var userAgentHTTPS string
+	flag.StringVar(&userAgentHTTPS, "A-https", "", "HTTP User-Agent to use for HTTPS probes (overrides -A and -A-file)")
+
+	// cookies to send with every request
+	var cookie string
+	flag.StringVar(&cookie, "cookie", "", "cookies to send with each request (e.g. \"name=value; name2=value2\")")
+
+	// Accept-Encoding header
+	var acceptEncoding string
+	flag.StringVar(&acceptEncoding, "accept-encoding", "", "Accept-Encoding header to send (e.g. gzip or identity, defaults to Go's own)")
+
+	// Host header override
+	var vhost string
+	flag.StringVar(&vhost, "vhost", "", "Host header to send instead of the probed host")
+
+	// HTTP/SOCKS5 proxy to use
+	var proxyURL string
+	flag.StringVar(&proxyURL, "proxy", "", "proxy URL (e.g., http://proxy:8080 or socks5://proxy:1080)")
+
+	var proxyEnv bool
+	flag.BoolVar(&proxyEnv, "proxy-env", false, "use the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables if no proxy flags are given")
+
+	var proxyUser string
+	flag.StringVar(&proxyUser, "proxy-user", "", "username for SOCKS5 proxy authentication")
+
+	var proxyPass string
+	flag.StringVar(&proxyPass, "proxy-pass", "", "password for SOCKS5 proxy authentication")
+
+	var httpProxyURL string
+	flag.StringVar(&httpProxyURL, "http-proxy", "", "proxy URL for HTTP requests, or \"direct\" (overrides -proxy)")
+
+	var httpsProxyURL string
+	flag.StringVar(&httpsProxyURL, "https-proxy", "", "proxy URL for HTTPS requests, or \"direct\" (overrides -proxy)")
+
+	// local address to send probes from
+	var sourceIP string
+	flag.StringVar(&sourceIP, "source-ip", "", "local IP address to send probes from")
+
+	// Unix socket to send every request to
+	var unixSocket string
+	flag.StringVar(&unixSocket, "unix", "", "connect to this Unix socket instead of the probed host, which is only used for the Host header")
+
+	// custom DNS resolvers
+	var resolvers probeArgs
+	flag.Var(&resolvers, "resolver", "DNS resolver to use (ip or ip:port, can be specified multiple times)")
+
+	// DNS caching
+	var useDNSCache bool
+	flag.BoolVar(&useDNSCache, "dns-cache", false, "only look up each hostname once, sharing the result between probes")
+
+	var resolveWorkers int
+	flag.IntVar(&resolveWorkers, "resolve-workers", 0, "look up hostnames ahead of probing them with this many workers, caching the results for the whole run")
+
+	// static host to IP mappings
+	var hostMaps probeArgs
+	flag.Var(&hostMaps, "H-map", "connect to a host at a fixed IP (host:ip, can be specified multiple times)")
+
+	// extra output flags
+	var showStatus bool
+	flag.BoolVar(&showStatus, "status", false, "show HTTP status code")
+
+	var showRequest bool
+	flag.BoolVar(&showRequest, "show-request", false, "show the method and URL of the final request that got the response")
+
+	var showServer bool
+	flag.BoolVar(&showServer, "server", false, "show Server header")
+
+	var showHeaderNames probeArgs
+	flag.Var(&showHeaderNames, "show-header", "show the value of this response header (can be specified multiple times)")
+
+	var showTitle bool
+	flag.BoolVar(&showTitle, "title", false, "show page title")
+
+	var titleTrunc int
+	flag.IntVar(&titleTrunc, "title-trunc", 0, "truncate titles in the output to this many characters (0 = no limit)")
+
+	var showProto bool
+	flag.BoolVar(&showProto, "proto", false, "show HTTP protocol version")
+
+	var showALPN bool
+	flag.BoolVar(&showALPN, "alpn", false, "show the protocol negotiated with ALPN in the TLS handshake")
+
+	var showWords bool
+	flag.BoolVar(&showWords, "wc", false, "show response body word count")
+
+	var showLines bool
+	flag.BoolVar(&showLines, "lc", false, "show response body line count")
+
+	var showEntropy bool
+	flag.BoolVar(&showEntropy, "entropy", false, "show the Shannon entropy of the response body (bits per byte)")
+
+	var showLocation bool
+	flag.BoolVar(&showLocation, "location", false, "show redirect Location header")
+
+	// redirect following
+	var followChain bool
+	flag.BoolVar(&followChain, "chain", false, "follow redirects (up to 10) and show the redirect chain")
+
+	var showUpgrade bool
+	flag.BoolVar(&showUpgrade, "upgrade", false, "mark HTTP URLs that redirect to HTTPS on the same host with [http->https]")
+
+	var showRefresh bool
+	flag.BoolVar(&showRefresh, "meta-refresh", false, "show the target of meta refresh and JavaScript redirects")
+
+	var showCertExpiry bool
+	flag.BoolVar(&showCertExpiry, "cert-expiry", false, "show days until the TLS certificate expires")
+
+	var showCertTrust bool
+	flag.BoolVar(&showCertTrust, "cert-trust", false, "show whether the TLS certificate is trusted by the system roots")
+
+	var showTiming bool
+	flag.BoolVar(&showTiming, "timing", false, "show a breakdown of DNS, connect, TLS and time to first byte")
+
+	var showHeaderCount bool
+	flag.BoolVar(&showHeaderCount, "hdr-count", false, "show the number of response headers and their total size")
+
+	var showTech bool
+	flag.BoolVar(&showTech, "tech", false, "show technologies and WAFs detected from the response headers")
+
+	// values to extract from the body
+	var extracts probeArgs
+	flag.Var(&extracts, "extract", "show the first capture group of this regex in the body (can be specified multiple times)")
+
+	// directory listing detection
+	var dirListing bool
+	flag.BoolVar(&dirListing, "dir-listing", false, "show whether responses look like directory listings")
+
+	// chunked transfer encoding
+	var showChunked bool
+	flag.BoolVar(&showChunked, "chunked", false, "show whether responses were sent with chunked transfer encoding")
+
+	// open redirect check
+	var checkRedirects bool
+	flag.BoolVar(&checkRedirects, "check-openredirect", false, "check whether hosts redirect to a URL given in common query parameters, marking them with [openredirect?]")
+
+	// allowed methods discovery
+	var allowMethods bool
+	flag.BoolVar(&allowMethods, "allow-methods", false, "send an OPTIONS request to each host and show the methods its Allow header lists")
+
+	// soft-404 detection
+	var soft404 bool
+	flag.BoolVar(&soft404, "soft404", false, "also request a random path on each host and mark responses that look the same with [soft-404]")
+
+	// result filters
+	var titleMatch string
+	flag.StringVar(&titleMatch, "title-match", "", "only output hosts whose title matches this regex")
+
+	var titleFilter string
+	flag.StringVar(&titleFilter, "title-filter", "", "don't output hosts whose title matches this regex")
+
+	var serverMatch string
+	flag.StringVar(&serverMatch, "server-match", "", "only output hosts whose Server header matches this regex (case-insensitive)")
+
+	var headerMatch string
+	flag.StringVar(&headerMatch, "header-match", "", "only output hosts with a response header matching a regex (e.g. \"Location: /login\")")
+
+	var maxRT int
+	flag.IntVar(&maxRT, "max-rt", 0, "only output hosts that respond within this time (milliseconds)")
+
+	// output destination and encoding
+	var outputFile string
+	flag.StringVar(&outputFile, "o", "", "write output to a file instead of stdout")
+
+	var jsonOutput bool
+	flag.BoolVar(&jsonOutput, "json", false, "output results as newline-delimited JSON")
+
+	var csvOutput bool
+	flag.BoolVar(&csvOutput, "csv", false, "output results as CSV, with a header row naming the columns")
+
+	var groupOutput bool
+	flag.BoolVar(&groupOutput, "group", false, "output all of the results for each input host together once it's finished")
+
+	// don't output the same URL twice
+	var dedupOutput bool
+	flag.BoolVar(&dedupOutput, "dedup-output", false, "only output each URL once, however many times it was probed")
+
+	var sortBy string
+	flag.StringVar(&sortBy, "sort", "", "output results sorted by url, status or title once the scan has finished")
+
+	var collapse bool
+	flag.BoolVar(&collapse, "collapse", false, "once the scan has finished, output hosts with identical bodies as a single result")
+
+	var timestamps bool
+	flag.BoolVar(&timestamps, "timestamp", false, "show the time each result was found")
+
+	var stream bool
+	flag.BoolVar(&stream, "stream", false, "flush each result as soon as it's written (JSON output is buffered otherwise)")
+
+	// custom output format
+	var format string
+	flag.StringVar(&format, "format", "", "output format using placeholders (e.g. \"{url} {status} {title}\")")
+
+	// rate limiting
+	var rateLimit float64
+	flag.Float64Var(&rateLimit, "rate", 0, "requests per second (0 = unlimited)")
+
+	var burst int
+	flag.IntVar(&burst, "burst", 1, "number of requests that can be sent at once before -rate applies")
+
+	// retrying throttled requests
+	var retries int
+	flag.IntVar(&retries, "retries", 0, "retry requests that get a 429 or 503 response up to this many times, waiting as long as Retry-After asks")
+
+	var maxRetryAfterSecs int
+	flag.IntVar(&maxRetryAfterSecs, "max-retry-after", 60, "longest Retry-After to wait for before retrying (seconds)")
+
+	// global deadline
+	var maxTime int
+	flag.IntVar(&maxTime, "max-time", 0, "maximum time to run for (seconds, 0 = unlimited)")
+
+	// output failed probes too
+	var showAll bool
+	flag.BoolVar(&showAll, "all", false, "output every probed URL, marking failed probes with [DEAD]")
+
+	// resume from a previous run's output
+	var resumeFile string
+	flag.StringVar(&resumeFile, "resume", "", "skip hosts already found live in this previous output file")
+
+	// SQLite output
+	var dbFile string
+	flag.StringVar(&dbFile, "db", "", "also write results to this SQLite database")
+
+	// webhook to POST live hosts to
+	var webhookURL string
+	flag.StringVar(&webhookURL, "webhook", "", "also POST each live host as JSON to this URL")
+
+	// Prometheus metrics
+	var metricsAddr string
+	flag.StringVar(&metricsAddr, "metrics", "", "serve Prometheus metrics on this address (e.g. :9090)")
+
+	// run summary
+	var summaryFile string
+	flag.StringVar(&summaryFile, "summary", "", "write a JSON summary of the scan to this file when it finishes")
+
+	// exit status
+	var failIfEmpty bool
+	flag.BoolVar(&failIfEmpty, "fail-if-empty", false, "exit with status 4 if no live hosts were output")
+
+	var exitOnMatch bool
+	flag.BoolVar(&exitOnMatch, "exit-on-match", false, "exit with status 3 if any live hosts were output")
+
+	// verbose error output
+	var verbose bool
+	flag.BoolVar(&verbose, "v", false, "output errors for failed probes to stderr")
+
+	// no output other than results
+	var silent bool
+	flag.BoolVar(&silent, "silent", false, "don't output warnings and notices to stderr, only errors that stop the scan or lose results")
+
+	// per-request delay
+	var delayMs int
+	flag.IntVar(&delayMs, "delay", 0, "delay before each request (milliseconds)")
+
+	var jitterMs int
+	flag.IntVar(&jitterMs, "jitter", 0, "maximum random extra delay before each request (milliseconds)")
+
+	// TLS certificate verification
+	var verifyTLS bool
+	flag.BoolVar(&verifyTLS, "verify", false, "verify TLS certificates (hosts with invalid certs will fail)")
+
+	// minimum TLS version
+	var minTLS string
+	flag.StringVar(&minTLS, "min-tls", "", "minimum TLS version to accept (1.0, 1.1, 1.2 or 1.3)")
+
+	// browser TLS fingerprint
+	var tlsProfile string
+	flag.StringVar(&tlsProfile, "tls-profile", "", "mimic a browser's TLS ClientHello (chrome, firefox, safari, edge, ios, android or randomized)")
+
+	// TLS server name override
+	var sni string
+	flag.StringVar(&sni, "sni", "", "TLS server name (SNI) to send instead of the probed host")
+
+	// client certificate for mutual TLS
+	var clientCert string
+	flag.StringVar(&clientCert, "client-cert", "", "client certificate file for mutual TLS (PEM)")
+
+	var clientKey string
+	flag.StringVar(&clientKey, "client-key", "", "client private key file for mutual TLS (PEM)")
+
+	// response storage
+	var storeResponses bool
+	flag.BoolVar(&storeResponses, "sr", false, "store response bodies in the output directory")
+
+	var storeDir string
+	flag.StringVar(&storeDir, "srd", "responses", "directory to store response bodies in (used with -sr)")
+
+	var maxBody int64
+	flag.Int64Var(&maxBody, "max-body", 0, "maximum number of response body bytes to read (0 = at most 8MB)")
+
+	var rangeBytes int64
+	flag.Int64Var(&rangeBytes, "range", 0, "only ask for (and read) the first n bytes of each response body")
+
+	// HTTP protocol version toggles
+	var forceHTTP2 bool
+	flag.BoolVar(&forceHTTP2, "http2", false, "attempt HTTP/2 over TLS")
+
+	var forceHTTP1 bool
+	flag.BoolVar(&forceHTTP1, "http1", false, "only use HTTP/1.x")
+
+	var http10 bool
+	flag.BoolVar(&http10, "http10", false, "send HTTP/1.0 requests")
+
+	// connection reuse
+	var keepAlive bool
+	flag.BoolVar(&keepAlive, "keep-alive", false, "reuse connections for further requests to the same host and port")
+
+	flag.Parse()
+
+	if configFile != "" {
+		if err := loadConfig(configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load config file: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if silent && verbose {
+		fmt.Fprintln(os.Stderr, "-silent and -v can't be used together")
+		os.Exit(1)
+	}
+
+	// notice writes a warning or notice to stderr, unless -silent
+	// is set
+	notice := func(format string, args ...any) {
+		if !silent {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		}
+	}
+
+	targets, err := parseProbes(probes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if portsFile != "" {
+		lines, err := readLines(portsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read ports file: %s\n", err)
+			os.Exit(1)
+		}
+
+		fileTargets, bad := parsePortLines(lines)
+		for _, err := range bad {
+			notice("skipping line in ports file: %s", err)
+		}
+		if len(fileTargets) == 0 {
+			fmt.Fprintf(os.Stderr, "No ports found in %s\n", portsFile)
+			os.Exit(1)
+		}
+		targets = append(targets, fileTargets...)
+	}
+
+	if httpsOnly && httpOnly {
+		fmt.Fprintln(os.Stderr, "-https-only and -http-only can't be used together")
+		os.Exit(1)
+	}
+	if (httpsOnly || httpOnly) && (bothSchemes || preferHTTPS) {
+		fmt.Fprintln(os.Stderr, "-https-only and -http-only can't be used with -both or -prefer-https")
+		os.Exit(1)
+	}
+
+	// with -https-only, plain HTTP probes are dropped here rather than
+	// being handed to a worker that would do nothing with them
+	if httpsOnly {
+		https := targets[:0]
+		for _, t := range targets {
+			if t.https {
+				https = append(https, t)
+			}
+		}
+		targets = https
+
+		if skipDefault && len(targets) == 0 {
+			fmt.Fprintln(os.Stderr, "-https-only leaves no probes to run")
+			os.Exit(1)
+		}
+	}
+
+	// without any -path flags each host is probed once, with no path
+	if len(paths) == 0 {
+		paths = probeArgs{""}
+	}
+	for i, path := range paths {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			paths[i] = "/" + path
+		}
+	}
+
+	// make an actual time.Duration out of the timeout
+	timeout := time.Duration(to * 1000000)
+
+	// without -connect-timeout connecting is limited by the overall
+	// timeout, which can be overridden for each input line
+	var connectTimeout time.Duration
+	if connectTo > 0 {
+		connectTimeout = time.Duration(connectTo) * time.Millisecond
+	}
+	readTimeout := time.Duration(readTo) * time.Millisecond
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: !verifyTLS}
+
+	if minTLS != "" {
+		version, ok := tlsVersions[minTLS]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Invalid minimum TLS version: %s (must be 1.0, 1.1, 1.2 or 1.3)\n", minTLS)
+			os.Exit(1)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	// the transport only fills in ServerName from the URL when it's
+	// empty, so setting it here overrides SNI for every connection
+	// without changing the dial address or Host header
+	tlsConfig.ServerName = sni
+
+	if clientCert != "" || clientKey != "" {
+		if clientCert == "" || clientKey == "" {
+			fmt.Fprintln(os.Stderr, "Both -client-cert and -client-key must be provided")
+			os.Exit(1)
+		}
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load client certificate: %s\n", err)
+			os.Exit(1)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: time.Second,
+	}
+
+	if sourceIP != "" {
+		ip := net.ParseIP(sourceIP)
+		if ip == nil {
+			fmt.Fprintf(os.Stderr, "Invalid source IP: %s\n", sourceIP)
+			os.Exit(1)
+		}
+
+		// make sure the address can actually be bound to now rather
+		// than failing every probe later
+		ln, err := net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to bind to source IP: %s\n", err)
+			os.Exit(1)
+		}
+		ln.Close()
+
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+
+	if len(resolvers) > 0 {
+		servers := make([]string, 0, len(resolvers))
+		for _, r := range resolvers {
+			server, err := normaliseResolver(r)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid resolver %s: %s\n", r, err)
+				os.Exit(1)
+			}
+			servers = append(servers, server)
+		}
+		dialer.Resolver = newResolver(servers, timeout)
+	}
+
+	var tr = &http.Transport{
+		MaxIdleConns:      30,
+		IdleConnTimeout:   time.Second,
+		DisableKeepAlives: true,
+		TLSClientConfig:   tlsConfig,
+		DialContext:       dialer.DialContext,
+	}
+
+	// with -keep-alive, idle connections are kept around long enough
+	// for the rest of a host's paths and ports to be probed, with room
+	// for every worker to be on the same host
+	if keepAlive {
+		tr.DisableKeepAlives = false
+		tr.IdleConnTimeout = 30 * time.Second
+		tr.MaxIdleConns = max(tr.MaxIdleConns, concurrency)
+		tr.MaxIdleConnsPerHost = concurrency
+	}
+
+	// SOCKS5 proxies are given hostnames to resolve themselves, so
+	// the cache goes under the proxy dialers. Hosts looked up ahead of
+	// time by -resolve-workers are kept for the whole run, so they
+	// aren't looked up again by the time they're probed.
+	if resolveWorkers < 0 {
+		fmt.Fprintln(os.Stderr, "-resolve-workers can't be negative")
+		os.Exit(1)
+	}
+	var cache *dnsCache
+	if useDNSCache || resolveWorkers > 0 {
+		ttl := dnsCacheTTL
+		if resolveWorkers > 0 {
+			ttl = 0
+		}
+		cache = newDNSCache(dialer.Resolver, ttl)
+		tr.DialContext = cache.wrap(tr.DialContext)
+	}
+
+	if forceHTTP2 && forceHTTP1 {
+		fmt.Fprintln(os.Stderr, "-http2 and -http1 can't be used together")
+		os.Exit(1)
+	}
+	if forceHTTP2 && http10 {
+		fmt.Fprintln(os.Stderr, "-http2 and -http10 can't be used together")
+		os.Exit(1)
+	}
+	if keepAlive && http10 {
+		fmt.Fprintln(os.Stderr, "-keep-alive can't be used with -http10")
+		os.Exit(1)
+	}
+	if tlsProfile != "" && (forceHTTP2 || http10) {
+		fmt.Fprintln(os.Stderr, "-tls-profile can't be used with -http2 or -http10")
+		os.Exit(1)
+	}
+
+	// HTTP/2 isn't enabled by default when a custom dialer and TLS
+	// config are set, so it has to be asked for explicitly
+	if forceHTTP2 {
+		tr.ForceAttemptHTTP2 = true
+	}
+
+	// a non-nil, empty TLSNextProto disables HTTP/2 entirely
+	if forceHTTP1 {
+		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	// with -proxy-env the environment is only used when no proxies
+	// have been given explicitly
+	useProxyEnv := proxyEnv && proxyURL == "" && httpProxyURL == "" && httpsProxyURL == ""
+
+	// Configure proxies if provided. The scheme specific proxies
+	// fall back to -proxy when they're not set.
+	if httpProxyURL == "" {
+		httpProxyURL = proxyURL
+	}
+	if httpsProxyURL == "" {
+		httpsProxyURL = proxyURL
+	}
+
+	routes := make(map[string]*url.URL)
+	for scheme, raw := range map[string]string{"http": httpProxyURL, "https": httpsProxyURL} {
+		u, err := parseProxy(raw)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid proxy URL: %s\n", err)
+			os.Exit(1)
+		}
+		routes[scheme] = u
+	}
+
+	// looking hosts up ahead of time would be wasted with a proxy, as
+	// the proxy does the lookups, and would leak the targets to the
+	// local resolver
+	if resolveWorkers > 0 && (useProxyEnv || routes["http"] != nil || routes["https"] != nil) {
+		fmt.Fprintln(os.Stderr, "-resolve-workers can't be used with a proxy")
+		os.Exit(1)
+	}
+
+	var proxyAuth *proxy.Auth
+	if proxyUser != "" || proxyPass != "" {
+		if !usesSOCKS5(routes) {
+			fmt.Fprintln(os.Stderr, "-proxy-user and -proxy-pass can only be used with a socks5:// proxy")
+			os.Exit(1)
+		}
+		proxyAuth = &proxy.Auth{User: proxyUser, Password: proxyPass}
+	}
+
+	if err := configureProxies(tr, dialer, routes, proxyAuth); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if useProxyEnv {
+		tr.Proxy = http.ProxyFromEnvironment
+	}
+
+	// HTTP/1.0 requests are sent by http10Transport, which dials
+	// directly and so only works with SOCKS5 proxies
+	if http10 && (useProxyEnv || usesHTTPProxy(routes)) {
+		fmt.Fprintln(os.Stderr, "-http10 can only be used with a socks5:// proxy")
+		os.Exit(1)
+	}
+
+	if len(hostMaps) > 0 {
+		mapping := make(map[string]string)
+		for _, m := range hostMaps {
+			host, ip, err := parseHostMapping(m)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid host mapping %s: %s\n", m, err)
+				os.Exit(1)
+			}
+			mapping[host] = ip
+		}
+		tr.DialContext = mapHosts(tr.DialContext, mapping)
+	}
+
+	if unixSocket != "" {
+		info, err := os.Stat(unixSocket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to use Unix socket: %s\n", err)
+			os.Exit(1)
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			fmt.Fprintf(os.Stderr, "Not a Unix socket: %s\n", unixSocket)
+			os.Exit(1)
+		}
+		for _, u := range routes {
+			if u != nil || useProxyEnv {
+				fmt.Fprintln(os.Stderr, "-unix can't be used with a proxy")
+				os.Exit(1)
+			}
+		}
+
+		// every connection goes to the socket, whatever the address
+		unixDialer := &net.Dialer{Timeout: connectTimeout}
+		tr.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return unixDialer.DialContext(ctx, "unix", unixSocket)
+		}
+	}
+
+	// with -tls-profile HTTPS connections are made by profileDialer.
+	// It can't be used with HTTP proxies, as the transport would send
+	// the ClientHello to the proxy instead of the host.
+	if tlsProfile != "" {
+		id, ok := tlsProfiles[strings.ToLower(tlsProfile)]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Invalid TLS profile: %s (must be one of %s)\n", tlsProfile, tlsProfileNames())
+			os.Exit(1)
+		}
+		if useProxyEnv || usesHTTPProxy(routes) {
+			fmt.Fprintln(os.Stderr, "-tls-profile can only be used with a socks5:// proxy")
+			os.Exit(1)
+		}
+		tr.DialTLSContext = profileDialer(tr.DialContext, id, tlsConfig)
+	}
+
+	if storeResponses {
+		if err := os.MkdirAll(storeDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create response directory: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// redirects are only followed with -chain, and even then we stop
+	// at maxRedirects, or as soon as a URL comes up a second time, and
+	// report the last response we got
+	re := func(req *http.Request, via []*http.Request) error {
+		if !followChain || len(via) > maxRedirects {
+			return http.ErrUseLastResponse
+		}
+		for _, v := range via {
+			if v.URL.String() == req.URL.String() {
+				return http.ErrUseLastResponse
+			}
+		}
+		return nil
+	}
+
+	var rt http.RoundTripper = tr
+	if http10 {
+		rt = http10Transport{dial: tr.DialContext, tlsConfig: tlsConfig}
+	}
+
+	client := &http.Client{
+		Transport:     schemeRecorder{rt},
+		CheckRedirect: re,
+		Timeout:       timeout,
+	}
+
+	// with a separate read timeout probeURL enforces the timeouts
+	// itself, as the client's timeout covers reading the body too
+	if readTimeout > 0 {
+		client.Timeout = 0
+	}
+
+	var outFormat outputFormat
+	if format != "" {
+		var err error
+		outFormat, err = parseFormat(format)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid output format: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if rangeBytes < 0 {
+		fmt.Fprintln(os.Stderr, "-range must be a positive number of bytes")
+		os.Exit(1)
+	}
+
+	if maxBody < 0 {
+		fmt.Fprintln(os.Stderr, "-max-body must be a positive number of bytes")
+		os.Exit(1)
+	}
+
+	var methods []string
+	for _, m := range strings.Split(methodList, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if m != "" {
+			methods = append(methods, m)
+		}
+	}
+	if methodList != "" && len(methods) == 0 {
+		fmt.Fprintln(os.Stderr, "-methods must include at least one method")
+		os.Exit(1)
+	}
+
+	if titleTrunc < 0 {
+		fmt.Fprintln(os.Stderr, "-title-trunc can't be negative")
+		os.Exit(1)
+	}
+
+	sortBy = strings.ToLower(sortBy)
+	if sortBy != "" && !sortKeys[sortBy] {
+		fmt.Fprintf(os.Stderr, "Invalid sort key: %s (must be url, status or title)\n", sortBy)
+		os.Exit(1)
+	}
+
+	// with -chrome, the Chrome headers are only used for the
+	// values that haven't been given explicitly
+	var extraHeaders [][2]string
+	if chrome {
+		given := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			given[f.Name] = true
+		})
+
+		if !given["A"] {
+			userAgent = chromeUserAgent
+		}
+		if acceptEncoding == "" {
+			acceptEncoding = chromeEncoding
+		}
+		extraHeaders = chromeHeaders
+	}
+
+	// -request-file takes the method, path, headers and body from the
+	// file, so it can't be combined with the flags that set them
+	var requestBody []byte
+	if requestFile != "" {
+		given := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			given[f.Name] = true
+		})
+		if given["path"] || given["method"] || given["methods"] || chrome {
+			fmt.Fprintln(os.Stderr, "-request-file can't be used with -path, -method, -methods or -chrome")
+			os.Exit(1)
+		}
+
+		tmpl, err := loadRequestFile(requestFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read request file: %s\n", err)
+			os.Exit(1)
+		}
+
+		method = tmpl.method
+		paths = probeArgs{tmpl.path}
+		extraHeaders = tmpl.headers
+		requestBody = tmpl.body
+		if tmpl.userAgent != "" && !given["A"] {
+			userAgent = tmpl.userAgent
+		}
+	}
+
+	if acceptEncoding != "" {
+		if err := validateAcceptEncoding(acceptEncoding); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -accept-encoding value: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var userAgents []string
+	if userAgentFile != "" {
+		var err error
+		userAgents, err = readLines(userAgentFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read User-Agent file: %s\n", err)
+			os.Exit(1)
+		}
+		if len(userAgents) == 0 {
+			fmt.Fprintf(os.Stderr, "No User-Agents found in %s\n", userAgentFile)
+			os.Exit(1)
+		}
+	}
+
+	var filter resultFilter
+	if titleMatch != "" {
+		filter.titleMatch, err = regexp.Compile(titleMatch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -title-match regex: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if titleFilter != "" {
+		filter.titleFilter, err = regexp.Compile(titleFilter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -title-filter regex: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if serverMatch != "" {
+		filter.serverMatch, err = regexp.Compile("(?i)" + serverMatch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -server-match regex: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// header names are canonicalised so they can be looked up in
+	// http.Header, but are otherwise shown as given
+	headerCols := make([]string, len(showHeaderNames))
+	for i, name := range showHeaderNames {
+		headerCols[i] = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	}
+
+	if headerMatch != "" {
+		filter.headerName, filter.headerMatch, err = parseHeaderMatch(headerMatch)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -header-match value: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	filter.maxDuration = time.Duration(maxRT) * time.Millisecond
+
+	liveCodes, err := parseStatusCodes(liveCodesFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -live-codes value: %s\n", err)
+		os.Exit(1)
+	}
+
+	var extractRes []*regexp.Regexp
+	for _, e := range extracts {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -extract regex: %s\n", err)
+			os.Exit(1)
+		}
+		extractRes = append(extractRes, re)
+	}
+
+	var outFile *os.File
+	out := bufio.NewWriter(os.Stdout)
+	if outputFile != "" {
+		outFile, err = os.Create(outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create output file: %s\n", err)
+			os.Exit(1)
+		}
+		out = bufio.NewWriter(outFile)
+	}
+
+	// hosts are read from the -l files in order, or from stdin if
+	// there aren't any
+	var inputs []*os.File
+	for _, name := range inputFiles {
+		if name == "-" {
+			inputs = append(inputs, os.Stdin)
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open input file: %s\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		inputs = append(inputs, f)
+	}
+	if len(inputs) == 0 {
+		inputs = append(inputs, os.Stdin)
+	}
+
+	var resumed map[string]bool
+	if resumeFile != "" {
+		var err error
+		resumed, err = loadResume(resumeFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read resume file: %s\n", err)
+			os.Exit(1)
+		}
+
+		// output written with -format can't be read back, so make
+		// sure it doesn't look like a scan that found nothing
+		if fi, err := os.Stat(resumeFile); err == nil && fi.Size() > 0 && len(resumed) == 0 {
+			notice("Warning: no live hosts found in %s, so none will be skipped", resumeFile)
+		}
+	}
+
+	var db *resultDB
+	if dbFile != "" {
+		var err error
+		db, err = openResultDB(dbFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open database: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var hook *webhook
+	if webhookURL != "" {
+		var err error
+		hook, err = newWebhook(webhookURL, notice)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid webhook URL: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	opts := probeOptions{
+		method:        method,
+		userAgent:     userAgent,
+		userAgents:    userAgents,
+		cookie:        cookie,
+		encoding:      acceptEncoding,
+		headers:       extraHeaders,
+		body:          requestBody,
+		vhost:         vhost,
+		keepAlive:     keepAlive,
+		needTitle:     showTitle || outFormat.uses("title") || db != nil || filter.needTitle() || sortBy == "title",
+		matchHeader:   filter.headerName,
+		headerNames:   headerCols,
+		needCounts:    showWords || showLines || outFormat.uses("words") || outFormat.uses("lines"),
+		needEntropy:   showEntropy || outFormat.uses("entropy"),
+		maxBody:       maxBody,
+		rangeBytes:    rangeBytes,
+		needChain:     followChain,
+		needCertTrust: showCertTrust,
+		timeout:       timeout,
+		readTimeout:   readTimeout,
+		needTiming:    showTiming,
+		needTech:      showTech,
+		needHash:      soft404 || collapse,
+		extract:       extractRes,
+		needRefresh:   showRefresh || outFormat.uses("refresh"),
+		needUpgrade:   showUpgrade || outFormat.uses("upgrade"),
+		needListing:   dirListing || outFormat.uses("listing"),
+	}
+	if storeResponses {
+		opts.storeDir = storeDir
+	}
+
+	outOpts := outputOptions{
+		showStatus:     showStatus,
+		showMethod:     len(methods) > 0,
+		showRequest:    showRequest,
+		showServer:     showServer,
+		showTitle:      showTitle,
+		titleTrunc:     titleTrunc,
+		showProto:      showProto,
+		showALPN:       showALPN,
+		showWords:      showWords,
+		showLines:      showLines,
+		showEntropy:    showEntropy,
+		showLocation:   showLocation,
+		showRefresh:    showRefresh,
+		showChain:      followChain,
+		showCertExpiry: showCertExpiry,
+		showCertTrust:  showCertTrust,
+		showTiming:     showTiming,
+		showTech:       showTech,
+		showHeaders:    showHeaderCount,
+		showListing:    dirListing,
+		showChunked:    showChunked,
+		showAllow:      allowMethods,
+		showTimestamp:  timestamps,
+		showCluster:    collapse,
+		showExtracts:   len(extractRes) > 0,
+		headerCols:     headerCols,
+		format:         outFormat,
+	}
+
+	// with -csv the header row is written straight away, naming the
+	// columns for the fields that are turned on. The markers that are
+	// only shown in plain text when they apply get columns of their own.
+	var csvOut *csv.Writer
+	var csvCols []string
+	if csvOutput {
+		if jsonOutput || format != "" {
+			fmt.Fprintln(os.Stderr, "-csv can't be used with -json or -format")
+			os.Exit(1)
+		}
+
+		csvCols = csvColumns(outOpts)
+		for _, c := range []struct {
+			on   bool
+			name string
+		}{
+			{showUpgrade, "upgrade"},
+			{followChain, "loop"},
+			{checkRedirects, "openredirect"},
+			{soft404, "soft404"},
+			{showAll && liveCodesFlag != "", "notlive"},
+			{tagSep != "", "label"},
+			{showAll, "error"},
+		} {
+			if c.on {
+				csvCols = append(csvCols, c.name)
+			}
+		}
+
+		csvOut = csv.NewWriter(out)
+		csvOut.Write(csvCols)
+		csvOut.Flush()
+	}
+
+	// ctx is cancelled to stop the scan early
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if maxTime > 0 {
+		deadline := time.AfterFunc(time.Duration(maxTime)*time.Second, func() {
+			notice("maximum run time reached, stopping early")
+			cancel()
+		})
+		defer deadline.Stop()
+	}
+
+	delay := time.Duration(delayMs) * time.Millisecond
+	jitter := time.Duration(jitterMs) * time.Millisecond
+
+	// set up rate limiter (nil if unlimited). It's shared by all
+	// workers and consulted once per request sent, so it limits the
+	// total request rate regardless of scheme.
+	if retries < 0 || maxRetryAfterSecs < 0 {
+		fmt.Fprintln(os.Stderr, "-retries and -max-retry-after can't be negative")
+		os.Exit(1)
+	}
+	maxRetryAfter := time.Duration(maxRetryAfterSecs) * time.Second
+
+	if burst < 1 {
+		fmt.Fprintln(os.Stderr, "Burst must be at least 1")
+		os.Exit(1)
+	}
+	if rateLimit > 0 {
+		opts.limiter = rate.NewLimiter(rate.Limit(rateLimit), burst)
+	}
+
+	if concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "Concurrency must be at least 1")
+		os.Exit(1)
+	}
+
+	if bothSchemes && preferHTTPS {
+		fmt.Fprintln(os.Stderr, "-both and -prefer-https can't be used together")
+		os.Exit(1)
+	}
+
+	if hostConcurrency < 0 {
+		fmt.Fprintln(os.Stderr, "Host concurrency can't be negative")
+		os.Exit(1)
+	}
+	if hostConcurrency > 0 {
+		opts.hosts = newHostLimiter(hostConcurrency)
+	}
+
+	if auxConcurrency < 0 {
+		fmt.Fprintln(os.Stderr, "Aux concurrency can't be negative")
+		os.Exit(1)
+	}
+
+	// domain/port pairs are sent to the workers as jobs on a single
+	// channel. Jobs that start with HTTPS are checked over HTTP
+	// afterwards by the same worker, unless they're listening and the
+	// --prefer-https flag is set.
+	jobs := make(chan probeJob)
+	output := make(chan probeOutput)
+
+	// the summary is counted up as the scan goes, and written once
+	// it's finished
+	var summary *runSummary
+	if summaryFile != "" {
+		summary = newRunSummary()
+	}
+
+	// start the metrics server if one was asked for
+	var stats *metrics
+	var metricsServer *http.Server
+	if metricsAddr != "" {
+		stats = newMetrics()
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", stats)
+		metricsServer = &http.Server{Addr: metricsAddr, Handler: mux}
+
+		ln, err := net.Listen("tcp", metricsAddr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to start metrics server: %s\n", err)
+			os.Exit(1)
+		}
+		go metricsServer.Serve(ln)
+	}
+
+	// running out of file descriptors fails probes in a way that looks
+	// like the host is dead, so they're retried after backing off and
+	// a warning is printed the first time it happens
+	var fdWarning sync.Once
+	warnFDs := func() {
+		fdWarning.Do(func() {
+			notice("Warning: out of file descriptors, backing off; try a lower -c (currently %d) or raising the limit with ulimit -n", concurrency)
+		})
+	}
+
+	// report sends the result of a probe to the output worker.
+	// Failed probes are only output with -all.
+	report := func(withProto string, result probeResult, group int) {
+		// probes that only failed because the scan was stopped
+		// didn't find anything out, so they aren't output or counted
+		if !result.success && ctx.Err() != nil {
+			return
+		}
+
+		result.found = time.Now()
+
+		if stats != nil {
+			stats.observe(result)
+		}
+		if summary != nil {
+			summary.observe(result)
+		}
+
+		if result.success && !filter.allow(result) {
+			return
+		}
+
+		// responses that don't have one of the -live-codes are only
+		// output with -all, like failures, and are marked as such
+		if result.success && !liveCodes.contains(result.status) {
+			if !showAll {
+				return
+			}
+			result.notLive = true
+		}
+
+		if !result.success {
+			if verbose {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", withProto, result.err)
+			}
+			if !showAll {
+				return
+			}
+		}
+		output <- probeOutput{url: withProto, result: result, group: group}
+	}
+
+	// needAux is set if live results have to wait on extra requests
+	// to their host before they're output
+	needAux := soft404 || checkRedirects || allowMethods
+
+	// auxCheck makes any extra requests to a result's host that it
+	// needs, then reports it. With -soft404 a random path is
+	// requested once per host, the first time one of its paths
+	// responds, and the same goes for the -check-openredirect canary
+	// and -allow-methods.
+	auxCheck := func(item auxItem) {
+		h, result := item.host, item.result
+
+		if soft404 {
+			h.baselineOnce.Do(func() {
+				sleepWithJitter(ctx, delay, jitter)
+				h.baseline = probeURL(ctx, h.client, h.base+randomPath(), h.baselineOpts)
+			})
+			result.soft404 = isSoft404(result, h.baseline)
+		}
+
+		if checkRedirects {
+			h.openRedirectOnce.Do(func() {
+				sleepWithJitter(ctx, delay, jitter)
+				h.openRedirect = checkOpenRedirect(ctx, h.client, h.base, h.opts)
+			})
+			result.openRedirect = h.openRedirect
+		}
+
+		if allowMethods {
+			h.allowOnce.Do(func() {
+				sleepWithJitter(ctx, delay, jitter)
+				h.allow = allowedMethods(ctx, h.client, h.base, h.opts)
+			})
+			result.allow = h.allow
+		}
+
+		report(item.url, result, item.group)
+	}
+
+	// with -aux-concurrency the extra requests are made by their own
+	// pool of workers, fed by a queue, so the probe workers can get
+	// on with the next job rather than waiting for them. Otherwise
+	// the probe workers make them themselves. Either way they go
+	// through -rate and -host-concurrency.
+	var auxQ *auxQueue
+	var auxWG sync.WaitGroup
+	if auxConcurrency > 0 && needAux {
+		auxQ = newAuxQueue()
+		for i := 0; i < auxConcurrency; i++ {
+			auxWG.Add(1)
+			go func() {
+				defer auxWG.Done()
+				for item := range auxQ.out {
+					if item.done {
+						item.pending.Wait()
+						output <- item.probeOutput
+						continue
+					}
+					auxCheck(item)
+					item.pending.Done()
+				}
+			}()
+		}
+	}
+
+	// probeHost probes every path on a host using the given scheme,
+	// reporting whether any of them responded with one of the
+	// -live-codes, and whether they all failed because the connection
+	// was refused. Results queued for the aux workers are counted in
+	// pending.
+	probeHost := func(scheme string, j probeJob, pending *sync.WaitGroup) (live, refused bool) {
+		refused = true
+		u := stripDefaultPort(scheme, j.target)
+
+		// a timeout given on the input line replaces -t
+		client, opts := client, opts
+		if j.timeout > 0 {
+			opts.timeout = j.timeout
+			if readTimeout == 0 {
+				c := *client
+				c.Timeout = j.timeout
+				client = &c
+			}
+		}
+
+		// -A-http and -A-https replace the User-Agent for their scheme
+		ua := userAgentHTTP
+		if scheme == "https" {
+			ua = userAgentHTTPS
+		}
+		if ua != "" {
+			opts.userAgent = ua
+			opts.userAgents = nil
+		}
+
+		aux := newAuxHost(scheme+"://"+u, client, opts)
+
+		for _, path := range paths {
+			// once the scan has been stopped the rest of the paths
+			// would only fail straight away
+			if ctx.Err() != nil {
+				break
+			}
+			sleepWithJitter(ctx, delay, jitter)
+
+			withProto := scheme + "://" + u + path
+			var result probeResult
+			backoff := fdBackoff
+			fdAttempts, retried := 0, 0
+			for {
+				if len(methods) > 0 {
+					result = probeMethods(ctx, client, withProto, opts, methods)
+				} else {
+					result = probeURL(ctx, client, withProto, opts)
+				}
+				if ctx.Err() != nil {
+					break
+				}
+
+				if isFDExhaustion(result.err) && fdAttempts < fdRetries {
+					fdAttempts++
+					warnFDs()
+					sleepWithJitter(ctx, backoff, backoff)
+					backoff *= 2
+					continue
+				}
+
+				// with -retries, hosts that ask us to come back later
+				// are given the time they asked for, up to a limit
+				if result.success && shouldRetry(result.status) && retried < retries {
+					retried++
+					sleepWithJitter(ctx, min(result.retryAfter, maxRetryAfter), 0)
+					continue
+				}
+				break
+			}
+
+			result.label = j.label
+
+			item := auxItem{
+				probeOutput: probeOutput{url: withProto, result: result, group: j.group},
+				host:        aux,
+				pending:     pending,
+			}
+			switch {
+			case !result.success || !needAux:
+				report(withProto, result, j.group)
+			case auxQ != nil:
+				pending.Add(1)
+				auxQ.in <- item
+			default:
+				auxCheck(item)
+			}
+
+			live = live || (result.success && liveCodes.contains(result.status))
+			refused = refused && result.errClass == "refused"
+		}
+		return live, refused
+	}
+
+	// Workers
+	var workersWG sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		workersWG.Add(1)
+
+		go func() {
+			for j := range jobs {
+				var pending sync.WaitGroup
+
+				switch {
+				case bothSchemes && j.https:
+					// with -both the HTTPS probe runs alongside HTTP
+					// rather than before it
+					done := make(chan struct{})
+					go func() {
+						probeHost("https", j, &pending)
+						close(done)
+					}()
+					probeHost("http", j, &pending)
+					<-done
+
+				default:
+					live, refused := false, false
+					if j.https && !httpOnly {
+						live, refused = probeHost("https", j, &pending)
+					}
+
+					// skip trying HTTP if --prefer-https is set, or
+					// if the port is closed and -skip-refused is set.
+					// Other failures, such as TLS errors, still fall
+					// back to HTTP as the port may be speaking it.
+					if !httpsOnly && (!live || !preferHTTPS) && !(refused && skipRefused) {
+						probeHost("http", j, &pending)
+					}
+				}
+
+				// with -group the output worker needs to know when
+				// each of a host's jobs has finished, which includes
+				// any of its results still waiting in the aux queue
+				if groupOutput {
+					done := probeOutput{done: true, group: j.group, groupSize: j.groupSize}
+					if auxQ != nil {
+						auxQ.in <- auxItem{probeOutput: done, pending: &pending}
+					} else {
+						output <- done
+					}
+				}
+			}
+
+			workersWG.Done()
+		}()
+	}
+
+	// Output worker
+	var outputWG sync.WaitGroup
+	var liveCount int
+	outputWG.Add(1)
+	go func() {
+		// with -dedup-output a hash of each URL written is kept,
+		// rather than the URL itself, to save memory on big scans
+		var written map[uint64]bool
+		if dedupOutput {
+			written = make(map[uint64]bool)
+		}
+
+		write := func(o probeOutput) {
+			if written != nil {
+				h := fnv.New64a()
+				h.Write([]byte(o.url))
+				sum := h.Sum64()
+				if written[sum] {
+					return
+				}
+				written[sum] = true
+			}
+
+			if o.result.success && !o.result.notLive {
+				liveCount++
+			}
+
+			var line string
+			switch {
+			case csvOut != nil:
+				csvOut.Write(csvRecord(csvCols, o.url, o.result, outOpts))
+				csvOut.Flush()
+			case jsonOutput:
+				jr := newJSONResult(o.url, o.result)
+				if timestamps {
+					jr.Time = &o.result.found
+				}
+				if showEntropy && o.result.success {
+					jr.Entropy = &o.result.entropy
+				}
+				if title := truncateTitle(jr.Title, titleTrunc); title != jr.Title {
+					jr.Title = title
+					jr.TitleLen = utf8.RuneCountInString(o.result.title)
+				}
+				j, err := json.Marshal(jr)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to encode %s as JSON: %s\n", o.url, err)
+					return
+				}
+				line = string(j)
+			default:
+				line = formatOutput(o.url, o.result, outOpts)
+			}
+
+			if csvOut == nil {
+				fmt.Fprintln(out, line)
+			}
+
+			// plain text has always been written a line at a time, so
+			// only JSON output is buffered unless -stream is set
+			if stream || !jsonOutput {
+				out.Flush()
+			}
+
+			if db != nil {
+				if err := db.insert(o.url, o.result); err != nil {
+					fmt.Fprintf(os.Stderr, "failed to write %s to database: %s\n", o.url, err)
+				}
+			}
+		}
+
+		// with -sort and -collapse every result is kept until the end
+		var sorted []probeOutput
+		emit := write
+		if sortBy != "" || collapse {
+			emit = func(o probeOutput) {
+				sorted = append(sorted, o)
+			}
+		}
+
+		// with -group results are held back until every job for
+		// their input line has finished
+		held := make(map[int][]probeOutput)
+		finished := make(map[int]int)
+
+		for o := range output {
+			// the webhook gets results as soon as they arrive, even
+			// if the output is being held back
+			if hook != nil && !o.done && o.result.success && !o.result.notLive {
+				body, err := json.Marshal(newJSONResult(o.url, o.result))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "failed to encode %s as JSON: %s\n", o.url, err)
+				} else {
+					hook.send(body)
+				}
+			}
+
+			if !groupOutput {
+				emit(o)
+				continue
+			}
+
+			if !o.done {
+				held[o.group] = append(held[o.group], o)
+				continue
+			}
+
+			finished[o.group]++
+			if finished[o.group] == o.groupSize {
+				for _, h := range held[o.group] {
+					emit(h)
+				}
+				delete(held, o.group)
+				delete(finished, o.group)
+			}
+		}
+
+		// if the scan was stopped early some hosts won't have
+		// finished, but their results are still worth writing
+		groups := make([]int, 0, len(held))
+		for g := range held {
+			groups = append(groups, g)
+		}
+		sort.Ints(groups)
+		for _, g := range groups {
+			for _, h := range held[g] {
+				emit(h)
+			}
+		}
+
+		if collapse {
+			sorted = collapseOutputs(sorted)
+		}
+		if sortBy != "" {
+			sortOutputs(sorted, sortBy)
+		}
+		for _, o := range sorted {
+			write(o)
+		}
+
+		outputWG.Done()
+	}()
+
+	// Close the output channel when the workers are done
+	go func() {
+		workersWG.Wait()
+		if auxQ != nil {
+			close(auxQ.in)
+			auxWG.Wait()
+		}
+		close(output)
+	}()
+
+	// read domains in the background so that the deadline can
+	// stop the scan even if we're waiting on input
+	lines := make(chan string)
+	go func() {
+		for _, in := range inputs {
+			sc := bufio.NewScanner(in)
+			for sc.Scan() {
+				line := strings.TrimSpace(sc.Text())
+				if isBlankOrComment(line) {
+					continue
+				}
+				lines <- line
+			}
+
+			// check there were no errors reading the input (unlikely)
+			if err := sc.Err(); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to read %s: %s\n", in.Name(), err)
+			}
+		}
+		close(lines)
+	}()
+
+	// send queues a job, giving up if the scan has been stopped
+	send := func(j probeJob) {
+		select {
+		case jobs <- j:
+		case <-ctx.Done():
+		}
+	}
+
+	// with -resolve-workers, the host on each input line is looked
+	// up by a pool of resolvers before its jobs are queued, so the
+	// probe workers don't have to wait for DNS
+	type resolveItem struct {
+		host string
+		jobs []probeJob
+	}
+	var resolveQueue chan resolveItem
+	var resolveWG sync.WaitGroup
+	if resolveWorkers > 0 {
+		resolveQueue = make(chan resolveItem)
+		for i := 0; i < resolveWorkers; i++ {
+			resolveWG.Add(1)
+			go func() {
+				defer resolveWG.Done()
+				for item := range resolveQueue {
+					if net.ParseIP(item.host) == nil {
+						cache.lookup(ctx, item.host)
+					}
+					for _, j := range item.jobs {
+						send(j)
+					}
+				}
+			}()
+		}
+	}
+
+	// submit queues the jobs for an input line
+	submit := func(host string, lineJobs []probeJob) {
+		if resolveQueue == nil {
+			for _, j := range lineJobs {
+				send(j)
+			}
+			return
+		}
+
+		select {
+		case resolveQueue <- resolveItem{host: host, jobs: lineJobs}:
+		case <-ctx.Done():
+		}
+	}
+
+	// group counts the input lines, for -group
+	var group int
+
+	// accept domains on stdin
+input:
+	for {
+		var domain, label string
+		var hostTimeout time.Duration
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				break input
+			}
+			if summary != nil {
+				summary.input()
+			}
+			line, hostTimeout = splitTimeout(line)
+			if tagSep != "" {
+				if i := strings.Index(line, tagSep); i != -1 {
+					line, label = line[:i], line[i+len(tagSep):]
+				}
+			}
+			domain = line
+			if !noLower {
+				domain = strings.ToLower(line)
+			}
+		case <-ctx.Done():
+			break input
+		}
+
+		// skip hosts that were already found in a previous run
+		if resumed[strings.ToLower(inputHostname(domain))] {
+			continue
+		}
+
+		host, port := splitTarget(domain)
+
+		// the settings shared by every job for this line
+		group++
+		base := probeJob{label: label, timeout: hostTimeout, group: group, groupSize: len(targets)}
+		if !skipDefault {
+			base.groupSize++
+		}
+
+		// submit standard port checks
+		var lineJobs []probeJob
+		if !skipDefault {
+			j := base
+			j.target, j.https = joinTarget(host, port), true
+			lineJobs = append(lineJobs, j)
+		}
+
+		// submit any additional proto:port probes
+		for _, t := range targets {
+			j := base
+			j.target, j.https = joinTarget(host, t.port), t.https
+			lineJobs = append(lineJobs, j)
+		}
+		submit(host, lineJobs)
+	}
+
+	if resolveQueue != nil {
+		close(resolveQueue)
+		resolveWG.Wait()
+	}
+
+	// once we've sent all the URLs off we can close the
+	// jobs channel. The workers will finish what they're
+	// doing and then call 'Done' on the WaitGroup
+	close(jobs)
+
+	// Wait until the output waitgroup is done
+	outputWG.Wait()
+
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write output: %s\n", err)
+	}
+	if outFile != nil {
+		if err := outFile.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write output: %s\n", err)
+		}
+	}
+
+	if db != nil {
+		if err := db.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write to database: %s\n", err)
+		}
+	}
+
+	if hook != nil {
+		// ctx has already been cancelled if -max-time stopped the
+		// scan, and the results found before then should still be
+		// sent, so the wait is only bounded by webhookDrain
+		hook.Close(context.Background())
+	}
+
+	if metricsServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		metricsServer.Shutdown(shutdownCtx)
+		shutdownCancel()
+	}
+
+	if summary != nil {
+		if err := summary.write(summaryFile, liveCount); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write summary: %s\n", err)
+		}
+	}
+
+	// exit status 2 is left to the flag package, which uses it for
+	// invalid flags
+	if failIfEmpty && liveCount == 0 {
+		os.Exit(4)
+	}
+	if exitOnMatch && liveCount > 0 {
+		os.Exit(3)
+	}
+}
+
+// readLines returns the lines of a file with surrounding whitespace
+// removed, skipping blank lines and comments
+func readLines(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if isBlankOrComment(line) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, sc.Err()
+}
+
+// sleepWithJitter sleeps for delay plus a random duration of up to
+// jitter, returning early if ctx is cancelled
+func sleepWithJitter(ctx context.Context, delay, jitter time.Duration) {
+	if jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	if delay <= 0 {
+		return
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// probeJob is a host (and optional port) for a worker to probe. If
+// https is set it's tried over HTTPS before HTTP. label is the part
+// of the input line after the -tag-sep separator, and timeout
+// replaces -t if it's set.
+type probeJob struct {
+	target  string
+	https   bool
+	label   string
+	timeout time.Duration
+
+	// group identifies the input line the job came from, and
+	// groupSize is how many jobs were made from that line
+	group     int
+	groupSize int
+}
+
+// probeOutput is a result on its way to the output worker. With
+// -group, a probeOutput with done set is also sent when each job
+// finishes.
+type probeOutput struct {
+	url    string
+	result probeResult
+
+	group     int
+	groupSize int
+	done      bool
+}
+
+type probeResult struct {
+	success bool
+	status  int
+
+	// method is the method that was used with -methods
+	method string
+
+	// requestMethod and requestURL are those of the last request
+	// sent, which is the one that got the response after any
+	// redirects
+	requestMethod string
+	requestURL    string
+
+	server string
+	title  string
+	proto  string
+	words  int
+	lines  int
+	ip     string
+
+	// entropy is the Shannon entropy of the body, in bits per byte
+	entropy float64
+
+	// alpn is the protocol agreed in the TLS handshake, which is
+	// empty for plain HTTP or if the server didn't pick one
+	alpn string
+
+	// location is the Location header of the (last) response, and
+	// chain is every URL visited when redirects are followed
+	location string
+	chain    []string
+
+	// retryAfter is how long a 429 or 503 response asked us to wait
+	// before trying again
+	retryAfter time.Duration
+
+	// redirectLoop is set if the chain ended with a redirect back to
+	// a URL that had already been visited
+	redirectLoop bool
+
+	// refresh is the target of a meta refresh or JavaScript redirect
+	// in the body
+	refresh string
+
+	// upgrade is set if an HTTP URL redirected to HTTPS on the same host
+	upgrade bool
+
+	// openRedirect is set if the host redirected to the canary with
+	// -check-openredirect
+	openRedirect bool
+
+	// allow is the Allow header of the host's response to an OPTIONS
+	// request, with -allow-methods
+	allow string
+
+	// certs is the certificate chain presented by HTTPS hosts
+	certs []*x509.Certificate
+
+	// certTrust is the outcome of verifying certs against the
+	// system roots, e.g. "trusted" or "self-signed"
+	certTrust string
+
+	// tech is the technologies detected from the response headers
+	tech []string
+
+	// headerCount is the number of distinct response headers, and
+	// headerBytes the size of all of them as they'd be sent
+	headerCount int
+	headerBytes int
+
+	// bodyHash is the hash of the body that was read, and soft404
+	// is set if it looks the same as a random path's
+	bodyHash [sha1.Size]byte
+	soft404  bool
+
+	// extracted holds the value found by each -extract regex, or
+	// an empty string if it didn't match
+	extracted []string
+
+	// dirListing is set if the body looks like a directory listing
+	dirListing bool
+
+	// header is the values of the response header named by
+	// -header-match
+	header []string
+
+	// headers holds the -show-header headers that the response had,
+	// with repeated headers joined by commas
+	headers map[string]string
+
+	// chunked is set if the response was sent with chunked transfer
+	// encoding rather than with a Content-Length
+	chunked bool
+
+	// label is carried through from the input line with -tag-sep
+	label string
+
+	// found is when the result was reported by the worker
+	found time.Time
+
+	// notLive is set for responses that don't have one of the
+	// -live-codes, which are only output with -all
+	notLive bool
+
+	// cluster is the other URLs with the same body, with -collapse
+	cluster []string
+
+	// duration is how long it took to get a response, and timing
+	// breaks that down further when -timing is used
+	duration time.Duration
+	timing   probeTiming
+
+	// err is the reason the probe failed, if it did, and errClass
+	// is its broad category from classifyError, e.g. "dns"
+	err      error
+	errClass string
+}
+
+// probeOptions holds the per-request settings shared by all workers
+type probeOptions struct {
+	method    string
+	userAgent string
+	cookie    string
+
+	// vhost overrides the Host header when set
+	vhost string
+
+	// keepAlive leaves connections open to be reused
+	keepAlive bool
+
+	// matchHeader is the name of a response header to keep the
+	// values of, for -header-match
+	matchHeader string
+
+	// headerNames are the response headers to show with -show-header
+	headerNames []string
+
+	// encoding is sent as the Accept-Encoding header when set
+	encoding string
+
+	// headers are added to every request
+	headers [][2]string
+
+	// body is sent with every request when set
+	body []byte
+
+	// userAgents, when non-empty, is used instead of userAgent
+	// with one picked at random for each request
+	userAgents []string
+
+	needTitle     bool
+	needCounts    bool
+	needEntropy   bool
+	needChain     bool
+	needCertTrust bool
+	needTiming    bool
+	needTech      bool
+	needHash      bool
+	needRefresh   bool
+	needUpgrade   bool
+	needListing   bool
+	needAllow     bool
+
+	// extract is matched against the body, see extractValue
+	extract []*regexp.Regexp
+
+	// storeDir is the directory response bodies are saved to;
+	// an empty string disables storing responses
+	storeDir string
+	maxBody  int64
+
+	// rangeBytes, if set, is sent as a Range header asking for just
+	// the start of the body. Servers can ignore it, so it also caps
+	// how much of the body is read.
+	rangeBytes int64
+
+	// if readTimeout is set, timeout only covers getting the response
+	// headers and readTimeout covers reading the body
+	timeout     time.Duration
+	readTimeout time.Duration
+
+	// limiter limits the overall request rate; nil means unlimited
+	limiter *rate.Limiter
+
+	// hosts limits the requests in flight to each host; nil means
+	// unlimited
+	hosts *hostLimiter
+}
+
+func probeURL(ctx context.Context, client *http.Client, url string, opts probeOptions) probeResult {
+	result := probeResult{}
+
+	reqCtx, cancelReq := context.WithCancel(ctx)
+	defer cancelReq()
+
+	var reqBody io.Reader
+	if len(opts.body) > 0 {
+		reqBody = bytes.NewReader(opts.body)
+	}
+
+	req, err := http.NewRequestWithContext(reqCtx, opts.method, url, reqBody)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	userAgent := opts.userAgent
+	if len(opts.userAgents) > 0 {
+		userAgent = opts.userAgents[rand.Intn(len(opts.userAgents))]
+	}
+	for _, h := range opts.headers {
+		req.Header.Add(h[0], h[1])
+	}
+	req.Header.Add("User-Agent", userAgent)
+	if opts.cookie != "" {
+		req.Header.Add("Cookie", opts.cookie)
+	}
+	if opts.vhost != "" {
+		req.Host = opts.vhost
+	}
+	if opts.encoding != "" {
+		req.Header.Add("Accept-Encoding", opts.encoding)
+	}
+	if opts.rangeBytes > 0 {
+		req.Header.Add("Range", fmt.Sprintf("bytes=0-%d", opts.rangeBytes-1))
+	}
+	if !opts.keepAlive {
+		req.Header.Add("Connection", "close")
+		req.Close = true
+	}
 
-	// skip default probes flag
-	var skipDefault bool
-	flag.BoolVar(&skipDefault, "s", false, "skip the default probes (http:80 and https:443)")
+	// record the address we actually connected to
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if addr, ok := info.Conn.RemoteAddr().(*net.TCPAddr); ok {
+				result.ip = addr.IP.String()
+			}
+		},
+	}
 
-	// timeout flag
-	var to int
-	flag.IntVar(&to, "t", 10000, "timeout (milliseconds)")
+	var timings *timingRecorder
+	if opts.needTiming {
+		timings = &timingRecorder{}
+		timings.hook(trace)
+	}
 
-	// prefer https
-	var preferHTTPS bool
-	flag.BoolVar(&preferHTTPS, "prefer-https", false, "only try plain HTTP if HTTPS fails")
+	// the transport only fills in resp.TLS for *tls.Conns, so keep
+	// the state of the handshake for connections made with
+	// -tls-profile
+	var handshake *tls.ConnectionState
+	timingDone := trace.TLSHandshakeDone
+	trace.TLSHandshakeDone = func(cs tls.ConnectionState, err error) {
+		if err == nil {
+			handshake = &cs
+		}
+		if timingDone != nil {
+			timingDone(cs, err)
+		}
+	}
 
-	// HTTP method to use
-	var method string
-	flag.StringVar(&method, "method", "GET", "HTTP method to use")
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
 
-	// HTTP User-Agent to use
-	var userAgent string
-	flag.StringVar(&userAgent, "A", "httprobe", "HTTP User-Agent to use")
+	// wait for a place with the host before waiting on the rate
+	// limiter, so as not to use up the rate on a request that then
+	// has to wait
+	var held string
+	if opts.hosts != nil {
+		host := req.URL.Hostname()
+		if err := opts.hosts.acquire(ctx, host); err != nil {
+			result.err = err
+			result.errClass = classifyError(err)
+			return result
+		}
+		held = host
+		defer func() {
+			if held != "" {
+				opts.hosts.release(held)
+			}
+		}()
+	}
 
-	// HTTP/SOCKS5 proxy to use
-	var proxyURL string
-	flag.StringVar(&proxyURL, "proxy", "", "proxy URL (e.g., http://proxy:8080 or socks5://proxy:1080)")
+	if opts.limiter != nil {
+		if err := opts.limiter.Wait(ctx); err != nil {
+			result.err = err
+			result.errClass = classifyError(err)
+			return result
+		}
+	}
 
-	// extra output flags
-	var showStatus bool
-	flag.BoolVar(&showStatus, "status", false, "show HTTP status code")
+	// with -chain each redirect that's followed is another request,
+	// so it has to wait for its host and the rate limiter too. The
+	// place with the previous host is given up first, as its request
+	// is done with.
+	if opts.hosts != nil || opts.limiter != nil {
+		c := *client
+		checkRedirect := client.CheckRedirect
+		c.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+			if checkRedirect != nil {
+				if err := checkRedirect(next, via); err != nil {
+					return err
+				}
+			} else if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
 
-	var showServer bool
-	flag.BoolVar(&showServer, "server", false, "show Server header")
+			if host := next.URL.Hostname(); opts.hosts != nil && !strings.EqualFold(host, held) {
+				opts.hosts.release(held)
+				held = ""
+				if err := opts.hosts.acquire(ctx, host); err != nil {
+					return err
+				}
+				held = host
+			}
 
-	var showTitle bool
-	flag.BoolVar(&showTitle, "title", false, "show page title")
+			if opts.limiter != nil {
+				return opts.limiter.Wait(ctx)
+			}
+			return nil
+		}
+		client = &c
+	}
 
-	// rate limiting
-	var rateLimit float64
-	flag.Float64Var(&rateLimit, "rate", 0, "requests per second (0 = unlimited)")
+	var headerTimer *time.Timer
+	if opts.readTimeout > 0 {
+		headerTimer = time.AfterFunc(opts.timeout, cancelReq)
+	}
 
-	flag.Parse()
+	result.requestMethod = req.Method
+	result.requestURL = req.URL.String()
 
-	// make an actual time.Duration out of the timeout
-	timeout := time.Duration(to * 1000000)
+	start := time.Now()
+	resp, err := client.Do(req)
+	result.duration = time.Since(start)
 
-	var tr = &http.Transport{
-		MaxIdleConns:      30,
-		IdleConnTimeout:   time.Second,
-		DisableKeepAlives: true,
-		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-		DialContext: (&net.Dialer{
-			Timeout:   timeout,
-			KeepAlive: time.Second,
-		}).DialContext,
+	// the headers are in (or the request failed), so the header timer
+	// mustn't go on to cancel anything
+	if headerTimer != nil {
+		headerTimer.Stop()
 	}
 
-	// Configure proxy if provided
-	if proxyURL != "" {
-		proxyParsed, err := url.Parse(proxyURL)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Invalid proxy URL: %s\n", err)
-			os.Exit(1)
+	if timings != nil {
+		result.timing = timings.timing()
+	}
+	if err != nil {
+		result.err = err
+		result.errClass = classifyError(err)
+		return result
+	}
+	result.requestMethod = resp.Request.Method
+	result.requestURL = resp.Request.URL.String()
+	defer func() {
+		// a connection can only be reused once its body has been
+		// read, so drain whatever's left of a small one, without
+		// going past -max-body or -range
+		if opts.keepAlive {
+			drain := minLimit(keepAliveDrain, minLimit(opts.maxBody, opts.rangeBytes))
+			io.Copy(io.Discard, io.LimitReader(resp.Body, drain))
 		}
+		resp.Body.Close()
+	}()
 
-		if proxyParsed.Scheme == "socks5" {
-			// SOCKS5 proxy - use custom dialer
-			dialer, err := proxy.FromURL(proxyParsed, proxy.Direct)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Failed to create SOCKS5 dialer: %s\n", err)
-				os.Exit(1)
-			}
-			if contextDialer, ok := dialer.(proxy.ContextDialer); ok {
-				tr.DialContext = contextDialer.DialContext
-			} else {
-				tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-					return dialer.Dial(network, addr)
-				}
+	if opts.readTimeout > 0 {
+		bodyTimer := time.AfterFunc(opts.readTimeout, cancelReq)
+		defer bodyTimer.Stop()
+	}
+
+	result.success = true
+	result.status = resp.StatusCode
+	result.server = resp.Header.Get("Server")
+	if shouldRetry(resp.StatusCode) {
+		result.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	result.proto = resp.Proto
+	result.location = resp.Header.Get("Location")
+	result.chunked = slices.Contains(resp.TransferEncoding, "chunked")
+	if opts.matchHeader != "" {
+		result.header = resp.Header.Values(opts.matchHeader)
+	}
+	for _, name := range opts.headerNames {
+		if vals := resp.Header.Values(name); len(vals) > 0 {
+			if result.headers == nil {
+				result.headers = make(map[string]string)
 			}
-		} else {
-			// HTTP/HTTPS proxy
-			tr.Proxy = http.ProxyURL(proxyParsed)
+			result.headers[name] = strings.Join(vals, ", ")
 		}
 	}
+	if opts.needAllow {
+		result.allow = resp.Header.Get("Allow")
+	}
 
-	re := func(req *http.Request, via []*http.Request) error {
-		return http.ErrUseLastResponse
+	if resp.TLS == nil && resp.Request.URL.Scheme == "https" {
+		resp.TLS = handshake
 	}
 
-	client := &http.Client{
-		Transport:     tr,
-		CheckRedirect: re,
-		Timeout:       timeout,
+	if resp.TLS != nil {
+		result.alpn = resp.TLS.NegotiatedProtocol
+		result.certs = resp.TLS.PeerCertificates
+
+		if opts.needCertTrust && len(result.certs) > 0 {
+			// check against the name sent in the handshake (-sni),
+			// which is empty when connecting to an IP address
+			name := resp.TLS.ServerName
+			if name == "" {
+				name = resp.Request.URL.Hostname()
+			}
+			result.certTrust = certTrust(result.certs, name)
+		}
 	}
 
-	// set up rate limiter (nil if unlimited)
-	var limiter *rate.Limiter
-	if rateLimit > 0 {
-		limiter = rate.NewLimiter(rate.Limit(rateLimit), 1)
+	if opts.needChain {
+		result.chain = redirectChain(resp)
+		result.redirectLoop = isRedirectLoop(resp, result.chain)
 	}
 
-	// domain/port pairs are initially sent on the httpsURLs channel.
-	// If they are listening and the --prefer-https flag is set then
-	// no HTTP check is performed; otherwise they're put onto the httpURLs
-	// channel for an HTTP check.
-	httpsURLs := make(chan string)
-	httpURLs := make(chan string)
-	output := make(chan string)
+	if opts.needUpgrade {
+		// with -chain the first redirect is in the chain, as the
+		// response is the one at the end of it
+		target := result.location
+		if len(result.chain) > 1 {
+			target = result.chain[1]
+		}
+		result.upgrade = isUpgrade(req.URL, target)
+	}
 
-	// HTTPS workers
-	var httpsWG sync.WaitGroup
-	for i := 0; i < concurrency/2; i++ {
-		httpsWG.Add(1)
+	if opts.needTech {
+		result.tech = detectTech(resp.Header)
+	}
 
-		go func() {
-			for u := range httpsURLs {
-				if limiter != nil {
-					limiter.Wait(context.Background())
-				}
+	result.headerCount = len(resp.Header)
+	result.headerBytes = headerSize(resp.Header)
 
-				// always try HTTPS first
-				withProto := "https://" + u
-				result := probeURL(client, withProto, method, userAgent, showTitle)
-				if result.success {
-					output <- formatOutput(withProto, result, showStatus, showServer, showTitle)
+	// if nothing needs the body it isn't read here. Without
+	// -keep-alive the connection is closed without reading any of
+	// it, and with it only a small body is drained so that the
+	// connection can be reused.
+	if !opts.needTitle && !opts.needRefresh && !opts.needListing && !opts.needCounts && !opts.needEntropy && !opts.needHash && len(opts.extract) == 0 && opts.storeDir == "" {
+		return result
+	}
 
-					// skip trying HTTP if --prefer-https is set
-					if preferHTTPS {
-						continue
-					}
-				}
+	// the title, refresh target and listing check only need the
+	// start of the document, but storing, counting, entropy, hashing
+	// and extracting need the whole body (up to -max-body). Either way
+	// the body is only read once.
+	decoded, err := decodeBody(resp)
+	if err != nil {
+		return result
+	}
 
-				httpURLs <- u
-			}
+	limit := int64(4096)
+	if opts.needCounts || opts.needEntropy || opts.needHash || len(opts.extract) > 0 || opts.storeDir != "" {
+		limit = defaultMaxBody
+		if opts.maxBody > 0 {
+			limit = 0
+		}
+	}
 
-			httpsWG.Done()
-		}()
+	// -max-body and -range cap how much of the body is ever read
+	limit = minLimit(limit, minLimit(opts.maxBody, opts.rangeBytes))
+
+	var r io.Reader = decoded
+	if limit > 0 {
+		r = io.LimitReader(decoded, limit)
 	}
 
-	// HTTP workers
-	var httpWG sync.WaitGroup
-	for i := 0; i < concurrency/2; i++ {
-		httpWG.Add(1)
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return result
+	}
 
-		go func() {
-			for u := range httpURLs {
-				if limiter != nil {
-					limiter.Wait(context.Background())
-				}
-				withProto := "http://" + u
-				result := probeURL(client, withProto, method, userAgent, showTitle)
-				if result.success {
-					output <- formatOutput(withProto, result, showStatus, showServer, showTitle)
-				}
-			}
+	if opts.storeDir != "" {
+		if err := storeResponse(opts.storeDir, url, body); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to store response for %s: %s\n", url, err)
+		}
+	}
 
-			httpWG.Done()
-		}()
+	if opts.needTitle {
+		result.title = extractTitle(string(body))
 	}
 
-	// Close the httpURLs channel when the HTTPS workers are done
-	go func() {
-		httpsWG.Wait()
-		close(httpURLs)
-	}()
+	if opts.needRefresh {
+		result.refresh = findRefresh(resp.Request.URL, string(body))
+	}
 
-	// Output worker
-	var outputWG sync.WaitGroup
-	outputWG.Add(1)
-	go func() {
-		for o := range output {
-			fmt.Println(o)
-		}
-		outputWG.Done()
-	}()
+	if opts.needListing {
+		result.dirListing = isDirListing(body)
+	}
 
-	// Close the output channel when the HTTP workers are done
-	go func() {
-		httpWG.Wait()
-		close(output)
-	}()
+	if opts.needCounts {
+		result.words = len(strings.Fields(string(body)))
+		result.lines = countLines(body)
+	}
 
-	// accept domains on stdin
-	sc := bufio.NewScanner(os.Stdin)
-	for sc.Scan() {
-		domain := strings.ToLower(sc.Text())
+	if opts.needEntropy {
+		result.entropy = shannonEntropy(body)
+	}
 
-		// submit standard port checks
-		if !skipDefault {
-			httpsURLs <- domain
-		}
+	if opts.needHash {
+		result.bodyHash = sha1.Sum(body)
+	}
 
-		// Adding port templates
-		xlarge := []string{"81", "300", "591", "593", "832", "981", "1010", "1311", "2082", "2087", "2095", "2096", "2480", "3000", "3128", "3333", "4243", "4567", "4711", "4712", "4993", "5000", "5104", "5108", "5800", "6543", "7000", "7396", "7474", "8000", "8001", "8008", "8014", "8042", "8069", "8080", "8081", "8088", "8090", "8091", "8118", "8123", "8172", "8222", "8243", "8280", "8281", "8333", "8443", "8500", "8834", "8880", "8888", "8983", "9000", "9043", "9060", "9080", "9090", "9091", "9200", "9443", "9800", "9981", "12443", "16080", "18091", "18092", "20720", "28017"}
-		large := []string{"81", "591", "2082", "2087", "2095", "2096", "3000", "8000", "8001", "8008", "8080", "8083", "8443", "8834", "8888"}
-		small := []string{"7000", "7001", "8000", "8001", "8008", "8080", "8083", "8443", "8834", "8888", "10000"}
+	for _, re := range opts.extract {
+		result.extracted = append(result.extracted, extractValue(re, body))
+	}
 
-		// submit any additional proto:port probes
-		for _, p := range probes {
-			switch p {
-			case "xlarge":
-				for _, port := range xlarge {
-					httpsURLs <- fmt.Sprintf("%s:%s", domain, port)
-				}
-			case "large":
-				for _, port := range large {
-					httpsURLs <- fmt.Sprintf("%s:%s", domain, port)
-				}
-			case "small":
-				for _, port := range small {
-					httpsURLs <- fmt.Sprintf("%s:%s", domain, port)
-				}
-			default:
-				pair := strings.SplitN(p, ":", 2)
-				if len(pair) != 2 {
-					continue
-				}
+	return result
+}
 
-				// This is a little bit funny as "https" will imply an
-				// http check as well unless the --prefer-https flag is
-				// set. On balance I don't think that's *such* a bad thing
-				// but it is maybe a little unexpected.
-				if strings.ToLower(pair[0]) == "https" {
-					httpsURLs <- fmt.Sprintf("%s:%s", domain, pair[1])
-				} else {
-					httpURLs <- fmt.Sprintf("%s:%s", domain, pair[1])
-				}
-			}
-		}
+// extractValue returns the first capture group of the first match of
+// re in body, or the whole match if re has no groups
+func extractValue(re *regexp.Regexp, body []byte) string {
+	m := re.FindSubmatch(body)
+	if m == nil {
+		return ""
+	}
+	if len(m) > 1 {
+		return string(m[1])
 	}
+	return string(m[0])
+}
 
-	// once we've sent all the URLs off we can close the
-	// input/httpsURLs channel. The workers will finish what they're
-	// doing and then call 'Done' on the WaitGroup
-	close(httpsURLs)
+// headersOnly returns a copy of the options with everything that
+// needs more than the response headers turned off
+func (o probeOptions) headersOnly() probeOptions {
+	o.needTitle = false
+	o.needCounts = false
+	o.needEntropy = false
+	o.needChain = false
+	o.needCertTrust = false
+	o.needTiming = false
+	o.needTech = false
+	o.needHash = false
+	o.needRefresh = false
+	o.needListing = false
+	o.needUpgrade = false
+	o.extract = nil
+	o.storeDir = ""
+	return o
+}
 
-	// check there were no errors reading stdin (unlikely)
-	if err := sc.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to read input: %s\n", err)
+// probeMethods probes a URL with each method in turn until one gets
+// a response other than 405 Method Not Allowed, returning the last
+// result along with the method that was used
+func probeMethods(ctx context.Context, client *http.Client, url string, opts probeOptions, methods []string) probeResult {
+	var result probeResult
+	for _, m := range methods {
+		opts.method = m
+		result = probeURL(ctx, client, url, opts)
+		result.method = m
+
+		if result.success && result.status != http.StatusMethodNotAllowed {
+			break
+		}
+		if ctx.Err() != nil {
+			break
+		}
 	}
+	return result
+}
 
-	// Wait until the output waitgroup is done
-	outputWG.Wait()
+// allowedMethods sends an OPTIONS request to a host, returning the
+// methods listed in the Allow header of its response. It's empty if
+// the request failed or the server didn't send an Allow header.
+func allowedMethods(ctx context.Context, client *http.Client, base string, opts probeOptions) string {
+	opts = opts.headersOnly()
+	opts.method = http.MethodOptions
+	opts.body = nil
+	opts.needAllow = true
+
+	return probeURL(ctx, client, base, opts).allow
 }
 
-type probeResult struct {
-	success bool
-	status  int
-	server  string
-	title   string
+// minLimit returns the smaller of two byte limits, where zero means
+// no limit
+func minLimit(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
 }
 
-func probeURL(client *http.Client, url, method, userAgent string, needBody bool) probeResult {
-	result := probeResult{}
+// isUpgrade reports whether a redirect from u to location moves from
+// HTTP to HTTPS on the same host
+func isUpgrade(u *url.URL, location string) bool {
+	if u.Scheme != "http" || location == "" {
+		return false
+	}
 
-	req, err := http.NewRequest(method, url, nil)
+	target, err := u.Parse(location)
 	if err != nil {
-		return result
+		return false
 	}
-	req.Header.Add("User-Agent", userAgent)
-	req.Header.Add("Connection", "close")
-	req.Close = true
+	return target.Scheme == "https" && strings.EqualFold(target.Hostname(), u.Hostname())
+}
 
-	resp, err := client.Do(req)
+// isRedirectLoop reports whether a response redirects back to one of
+// the URLs in the chain that led to it
+func isRedirectLoop(resp *http.Response, chain []string) bool {
+	target, err := resp.Location()
 	if err != nil {
-		return result
+		return false
+	}
+	for _, u := range chain {
+		if u == target.String() {
+			return true
+		}
 	}
-	defer resp.Body.Close()
+	return false
+}
 
-	result.success = true
-	result.status = resp.StatusCode
-	result.server = resp.Header.Get("Server")
+// redirectChain returns the URLs visited on the way to a response,
+// starting with the original request
+func redirectChain(resp *http.Response) []string {
+	var chain []string
+	for req := resp.Request; req != nil; {
+		chain = append([]string{req.URL.String()}, chain...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+	return chain
+}
 
-	if needBody {
-		// read limited body for title extraction
-		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
-		if err == nil {
-			result.title = extractTitle(string(body))
+// headerSize returns the number of bytes taken up by a set of headers
+// on the wire, counting each "Name: value\r\n" line
+func headerSize(h http.Header) int {
+	n := 0
+	for name, values := range h {
+		for _, v := range values {
+			n += len(name) + len(": ") + len(v) + len("\r\n")
 		}
-	} else {
-		io.Copy(ioutil.Discard, resp.Body)
 	}
+	return n
+}
 
-	return result
+// countLines returns the number of lines in body, counting a
+// trailing line without a newline as a line
+func countLines(body []byte) int {
+	if len(body) == 0 {
+		return 0
+	}
+	n := bytes.Count(body, []byte("\n"))
+	if body[len(body)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// storeResponse writes a response body to a file in dir named after
+// the URL, with a short hash of the URL appended to avoid collisions
+// between URLs that sanitize to the same name
+func storeResponse(dir, u string, body []byte) error {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, u)
+
+	sum := sha1.Sum([]byte(u))
+	name = fmt.Sprintf("%s.%x.txt", name, sum[:4])
+
+	return ioutil.WriteFile(filepath.Join(dir, name), body, 0644)
 }
 
 func extractTitle(body string) string {
@@ -341,24 +2632,239 @@ func extractTitle(body string) string {
 	return title
 }
 
-func formatOutput(url string, r probeResult, showStatus, showServer, showTitle bool) string {
+// outputOptions controls which extra columns formatOutput includes
+type outputOptions struct {
+	showStatus     bool
+	showMethod     bool
+	showRequest    bool
+	showServer     bool
+	showTitle      bool
+	showProto      bool
+	showALPN       bool
+	showWords      bool
+	showLines      bool
+	showEntropy    bool
+	showLocation   bool
+	showRefresh    bool
+	showChain      bool
+	showCertExpiry bool
+	showCertTrust  bool
+	showTiming     bool
+	showTech       bool
+	showHeaders    bool
+	showListing    bool
+	showChunked    bool
+	showAllow      bool
+	showExtracts   bool
+	showTimestamp  bool
+	showCluster    bool
+
+	// titleTrunc is the most characters of a title to show
+	titleTrunc int
+
+	// headerCols are the -show-header headers, shown in order
+	headerCols []string
+
+	// format overrides the columns above when set
+	format outputFormat
+}
+
+// truncateTitle shortens a title to n characters, ending it with an
+// ellipsis. Titles are left alone if n is zero.
+func truncateTitle(title string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(title) <= n {
+		return title
+	}
+	return string([]rune(title)[:n]) + "…"
+}
+
+func formatOutput(url string, r probeResult, opts outputOptions) string {
+	// the title is only cut short for display, so filtering and
+	// sorting have already seen the whole thing
+	r.title = truncateTitle(r.title, opts.titleTrunc)
+
+	if !r.success {
+		out := url + " [DEAD]"
+		if r.errClass != "" {
+			out += fmt.Sprintf(" [%s]", r.errClass)
+		}
+		if r.label != "" {
+			out += fmt.Sprintf(" [%s]", r.label)
+		}
+		if opts.showTimestamp {
+			out += fmt.Sprintf(" [%s]", r.found.Format(time.RFC3339))
+		}
+		return out
+	}
+
+	if opts.format != nil {
+		return opts.format.render(url, r)
+	}
+
 	out := url
-	if showStatus {
+	if opts.showMethod {
+		out += fmt.Sprintf(" [%s]", r.method)
+	}
+	if opts.showRequest {
+		out += fmt.Sprintf(" [%s %s]", r.requestMethod, r.requestURL)
+	}
+	if opts.showStatus {
 		out += fmt.Sprintf(" [%d]", r.status)
 	}
-	if showServer {
+	if opts.showServer {
 		server := r.server
 		if server == "" {
 			server = "-"
 		}
 		out += fmt.Sprintf(" [%s]", server)
 	}
-	if showTitle {
+	for _, name := range opts.headerCols {
+		val := "-"
+		if v, ok := r.headers[name]; ok {
+			val = v
+		}
+		out += fmt.Sprintf(" [%s]", val)
+	}
+	if opts.showTitle {
 		title := r.title
 		if title == "" {
 			title = "-"
 		}
 		out += fmt.Sprintf(" [%s]", title)
 	}
+	if opts.showProto {
+		proto := r.proto
+		if proto == "" {
+			proto = "-"
+		}
+		out += fmt.Sprintf(" [%s]", proto)
+	}
+	if opts.showALPN {
+		alpn := r.alpn
+		if alpn == "" {
+			alpn = "-"
+		}
+		out += fmt.Sprintf(" [%s]", alpn)
+	}
+	if opts.showWords {
+		out += fmt.Sprintf(" [%d]", r.words)
+	}
+	if opts.showLines {
+		out += fmt.Sprintf(" [%d]", r.lines)
+	}
+	if opts.showEntropy {
+		out += fmt.Sprintf(" [%.2f]", r.entropy)
+	}
+	if opts.showLocation {
+		location := r.location
+		if location == "" {
+			location = "-"
+		}
+		out += fmt.Sprintf(" [%s]", location)
+	}
+	if opts.showRefresh {
+		refresh := r.refresh
+		if refresh == "" {
+			refresh = "-"
+		}
+		out += fmt.Sprintf(" [%s]", refresh)
+	}
+	if opts.showChain {
+		chain := "-"
+		if len(r.chain) > 1 {
+			chain = strings.Join(r.chain, " -> ")
+		}
+		out += fmt.Sprintf(" [%s]", chain)
+	}
+	if opts.showCertExpiry {
+		out += fmt.Sprintf(" [%s]", certExpiry(r))
+	}
+	if opts.showCertTrust {
+		trust := r.certTrust
+		if trust == "" {
+			trust = "-"
+		}
+		out += fmt.Sprintf(" [%s]", trust)
+	}
+	if opts.showTiming {
+		out += fmt.Sprintf(" [%s]", r.timing)
+	}
+	if opts.showHeaders {
+		out += fmt.Sprintf(" [h:%d %dB]", r.headerCount, r.headerBytes)
+	}
+	if opts.showTech {
+		tech := "-"
+		if len(r.tech) > 0 {
+			tech = strings.Join(r.tech, ",")
+		}
+		out += fmt.Sprintf(" [%s]", tech)
+	}
+	if opts.showAllow {
+		allow := "-"
+		if r.allow != "" {
+			allow = r.allow
+		}
+		out += fmt.Sprintf(" [%s]", allow)
+	}
+	if opts.showListing {
+		listing := "-"
+		if r.dirListing {
+			listing = "listing"
+		}
+		out += fmt.Sprintf(" [%s]", listing)
+	}
+	if opts.showChunked {
+		chunked := "-"
+		if r.chunked {
+			chunked = "chunked"
+		}
+		out += fmt.Sprintf(" [%s]", chunked)
+	}
+	if opts.showExtracts {
+		for _, e := range r.extracted {
+			if e == "" {
+				e = "-"
+			}
+			out += fmt.Sprintf(" [%s]", e)
+		}
+	}
+	if r.upgrade {
+		out += " [http->https]"
+	}
+	if r.redirectLoop {
+		out += " [redirect-loop]"
+	}
+	if r.openRedirect {
+		out += " [openredirect?]"
+	}
+	if r.soft404 {
+		out += " [soft-404]"
+	}
+	if r.notLive {
+		out += " [not-live]"
+	}
+	if r.label != "" {
+		out += fmt.Sprintf(" [%s]", r.label)
+	}
+	if opts.showTimestamp {
+		out += fmt.Sprintf(" [%s]", r.found.Format(time.RFC3339))
+	}
+	if opts.showCluster && len(r.cluster) > 0 {
+		out += fmt.Sprintf(" [+%d: %s]", len(r.cluster), strings.Join(r.cluster, ", "))
+	}
 	return out
 }
+
+// certExpiry describes how long is left before the leaf certificate
+// of a result expires
+func certExpiry(r probeResult) string {
+	if len(r.certs) == 0 {
+		return "-"
+	}
+
+	left := time.Until(r.certs[0].NotAfter)
+	if left < 0 {
+		return "EXPIRED"
+	}
+	return fmt.Sprintf("expires in %dd", int(left.Hours()/24))
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// TestMain runs httprobe itself instead of the tests when the
+// HTTPROBE_RUN_MAIN environment variable is set, so that runHTTProbe
+// can run it as a subprocess
+func TestMain(m *testing.M) {
+	if os.Getenv("HTTPROBE_RUN_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runHTTProbe runs httprobe with the given arguments and input,
+// returning its output
+func runHTTProbe(t *testing.T, input string, args ...string) string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "HTTPROBE_RUN_MAIN=1")
+	cmd.Stdin = strings.NewReader(input)
+
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		t.Fatalf("httprobe %s timed out", strings.Join(args, " "))
+	}
+	if err != nil {
+		t.Fatalf("httprobe %s failed: %s", strings.Join(args, " "), err)
+	}
+	return string(out)
+}
+
+// serverPort returns the port a test server is listening on
+func serverPort(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Port()
+}
+
+func TestSingleWorker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	port := serverPort(t, srv)
+
+	out := runHTTProbe(t, "127.0.0.1\n", "-c", "1", "-s", "-p", "http:"+port)
+
+	want := "http://127.0.0.1:" + port + "\n"
+	if out != want {
+		t.Errorf("got output %q, want %q", out, want)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	port := serverPort(t, srv)
+
+	// two hosts with five paths each, spread over plenty of workers
+	args := []string{"-c", "10", "-rate", "20", "-s", "-p", "http:" + port}
+	for _, p := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		args = append(args, "-path", p)
+	}
+	runHTTProbe(t, "127.0.0.1\nlocalhost\n", args...)
+
+	if len(times) != 10 {
+		t.Fatalf("got %d requests, want 10", len(times))
+	}
+
+	// with a burst of 1, at 20 per second the requests must be spread
+	// over at least 9/20 seconds. A little slack allows for the
+	// requests arriving in a different order to the one they were
+	// let through in.
+	elapsed := times[len(times)-1].Sub(times[0])
+	if want := 9 * time.Second / 20; elapsed < want*9/10 {
+		t.Errorf("10 requests took %s at -rate 20, want at least %s", elapsed, want)
+	}
+}
+
+func TestRateLimitRedirects(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+
+		// /5 redirects to /4 and so on down to /0
+		if p := r.URL.Path; p != "/0" {
+			http.Redirect(w, r, "/"+string(p[1]-1), http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	opts := probeOptions{
+		method:  http.MethodGet,
+		limiter: rate.NewLimiter(20, 1),
+		hosts:   newHostLimiter(1),
+	}
+	result := probeURL(context.Background(), srv.Client(), srv.URL+"/5", opts)
+	if !result.success || result.status != http.StatusOK {
+		t.Fatalf("got success %v, status %d, error %v; want a 200", result.success, result.status, result.err)
+	}
+
+	if len(times) != 6 {
+		t.Fatalf("got %d requests, want 6", len(times))
+	}
+
+	// every redirect followed waits on the limiter as well
+	elapsed := times[len(times)-1].Sub(times[0])
+	if want := 5 * time.Second / 20; elapsed < want*9/10 {
+		t.Errorf("6 requests took %s at 20 per second, want at least %s", elapsed, want)
+	}
+}
+
+func TestRateLimitCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// use up the only token, so the probe has to wait an hour
+	limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+	limiter.Allow()
+
+	opts := probeOptions{method: http.MethodGet, limiter: limiter}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan probeResult)
+	go func() {
+		done <- probeURL(ctx, srv.Client(), srv.URL, opts)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case result := <-done:
+		if result.success || result.err == nil {
+			t.Errorf("got success %v, error %v; want a failure", result.success, result.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("probe still waiting on the limiter after cancelling")
+	}
+}
+
+// countingConn counts the bytes read from a connection
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+func TestNoBodyRead(t *testing.T) {
+	const bodySize = 32 << 20
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 64<<10)
+		for written := 0; written < bodySize; written += len(chunk) {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	var read atomic.Int64
+	tr := &http.Transport{
+		DisableKeepAlives: true,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{conn, &read}, nil
+		},
+	}
+	client := &http.Client{Transport: tr}
+
+	result := probeURL(context.Background(), client, srv.URL, probeOptions{method: http.MethodGet})
+	if !result.success {
+		t.Fatalf("probe failed: %s", result.err)
+	}
+
+	// nothing needs the body, so hardly any of it should be read
+	t.Logf("read %d bytes of a %d byte response", read.Load(), bodySize)
+	if n := read.Load(); n > 1<<20 {
+		t.Errorf("read %d bytes of a %d byte response when no body was needed", n, bodySize)
+	}
+}
+
+// benchmarkPortScan probes HTTPS servers on several ports of the same
+// host, as a scan of a port template would
+func benchmarkPortScan(b *testing.B, keepAlive bool) {
+	var urls []string
+	for i := 0; i < 10; i++ {
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+
+	tr := &http.Transport{
+		MaxIdleConns:      30,
+		IdleConnTimeout:   time.Second,
+		DisableKeepAlives: true,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+	}
+	if keepAlive {
+		tr.DisableKeepAlives = false
+		tr.IdleConnTimeout = 30 * time.Second
+	}
+	defer tr.CloseIdleConnections()
+
+	client := &http.Client{Transport: tr}
+	opts := probeOptions{method: http.MethodGet, keepAlive: keepAlive}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, u := range urls {
+			if result := probeURL(context.Background(), client, u, opts); !result.success {
+				b.Fatalf("probe failed: %s", result.err)
+			}
+		}
+	}
+}
+
+func BenchmarkPortScan(b *testing.B) {
+	b.Run("close", func(b *testing.B) { benchmarkPortScan(b, false) })
+	b.Run("keep-alive", func(b *testing.B) { benchmarkPortScan(b, true) })
+}
+
+func TestDefaultMaxBody(t *testing.T) {
+	const bodySize = defaultMaxBody + 4<<20
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// one byte per line, so the line count is the bytes read
+		w.Write([]byte(strings.Repeat("\n", bodySize)))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		maxBody int64
+		want    int
+	}{
+		{0, defaultMaxBody},
+		{bodySize * 2, bodySize},
+		{1024, 1024},
+	}
+
+	for _, tt := range tests {
+		opts := probeOptions{method: http.MethodGet, needCounts: true, maxBody: tt.maxBody}
+		result := probeURL(context.Background(), srv.Client(), srv.URL, opts)
+		if !result.success {
+			t.Fatalf("probe failed: %s", result.err)
+		}
+		if result.lines != tt.want {
+			t.Errorf("with -max-body %d got %d lines, want %d", tt.maxBody, result.lines, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the probe
+// duration histogram
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics collects counters about the probes sent and serves them in
+// the Prometheus text exposition format
+type metrics struct {
+	sync.Mutex
+
+	probes    uint64
+	successes uint64
+	failures  map[string]uint64
+
+	// buckets holds the non-cumulative count for each latency
+	// bucket, with a final entry for durations over the last bound
+	buckets     []uint64
+	durationSum float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		failures: make(map[string]uint64),
+		buckets:  make([]uint64, len(latencyBuckets)+1),
+	}
+}
+
+// observe records the outcome of a single probe
+func (m *metrics) observe(r probeResult) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.probes++
+	if r.success {
+		m.successes++
+	} else {
+		m.failures[classifyError(r.err)]++
+	}
+
+	secs := r.duration.Seconds()
+	m.durationSum += secs
+
+	i := sort.SearchFloat64s(latencyBuckets, secs)
+	m.buckets[i]++
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP httprobe_probes_total Total number of probes sent.")
+	fmt.Fprintln(w, "# TYPE httprobe_probes_total counter")
+	fmt.Fprintf(w, "httprobe_probes_total %d\n", m.probes)
+
+	fmt.Fprintln(w, "# HELP httprobe_probe_successes_total Number of probes that got a response.")
+	fmt.Fprintln(w, "# TYPE httprobe_probe_successes_total counter")
+	fmt.Fprintf(w, "httprobe_probe_successes_total %d\n", m.successes)
+
+	classes := make([]string, 0, len(m.failures))
+	for class := range m.failures {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	fmt.Fprintln(w, "# HELP httprobe_probe_failures_total Number of failed probes by error class.")
+	fmt.Fprintln(w, "# TYPE httprobe_probe_failures_total counter")
+	for _, class := range classes {
+		fmt.Fprintf(w, "httprobe_probe_failures_total{class=%q} %d\n", class, m.failures[class])
+	}
+
+	fmt.Fprintln(w, "# HELP httprobe_probe_duration_seconds Time taken to get a response.")
+	fmt.Fprintln(w, "# TYPE httprobe_probe_duration_seconds histogram")
+	var cumulative uint64
+	for i, bound := range latencyBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(w, "httprobe_probe_duration_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+	fmt.Fprintf(w, "httprobe_probe_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.probes)
+	fmt.Fprintf(w, "httprobe_probe_duration_seconds_sum %g\n", m.durationSum)
+	fmt.Fprintf(w, "httprobe_probe_duration_seconds_count %d\n", m.probes)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// redirectCanary is the host used by -check-openredirect. It's under
+// a reserved TLD so it can never be a real site.
+const redirectCanary = "httprobe-canary.invalid"
+
+// redirectParams are the query parameters the canary is sent in
+var redirectParams = []string{"redirect", "redirect_uri", "url", "next", "return", "returnTo", "dest", "continue"}
+
+// canaryURL returns the URL to request on a host to check whether it
+// redirects to the canary
+func canaryURL(base string) string {
+	q := url.Values{}
+	for _, p := range redirectParams {
+		q.Set(p, "http://"+redirectCanary+"/")
+	}
+	return base + "/?" + q.Encode()
+}
+
+// checkOpenRedirect requests the canary URL on a host and reports
+// whether the response redirects to the canary host. Redirects are
+// never followed, and only the headers of the response are needed.
+func checkOpenRedirect(ctx context.Context, client *http.Client, base string, opts probeOptions) bool {
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	result := probeURL(ctx, &c, canaryURL(base), opts.headersOnly())
+	if !result.success || result.location == "" {
+		return false
+	}
+
+	// protocol-relative and backslash tricks are still redirects to
+	// the canary as far as a browser is concerned
+	loc := strings.ReplaceAll(result.location, `\`, "/")
+	u, err := url.Parse(loc)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Hostname(), redirectCanary)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// portTemplates are the named port lists that can be given to -p
+var portTemplates = map[string][]string{
+	"xlarge": {"81", "300", "591", "593", "832", "981", "1010", "1311", "2082", "2087", "2095", "2096", "2480", "3000", "3128", "3333", "4243", "4567", "4711", "4712", "4993", "5000", "5104", "5108", "5800", "6543", "7000", "7396", "7474", "8000", "8001", "8008", "8014", "8042", "8069", "8080", "8081", "8088", "8090", "8091", "8118", "8123", "8172", "8222", "8243", "8280", "8281", "8333", "8443", "8500", "8834", "8880", "8888", "8983", "9000", "9043", "9060", "9080", "9090", "9091", "9200", "9443", "9800", "9981", "12443", "16080", "18091", "18092", "20720", "28017"},
+	"large":  {"81", "591", "2082", "2087", "2095", "2096", "3000", "8000", "8001", "8008", "8080", "8083", "8443", "8834", "8888"},
+	"small":  {"7000", "7001", "8000", "8001", "8008", "8080", "8083", "8443", "8834", "8888", "10000"},
+}
+
+// probeTarget is an additional port to probe on every host. Probes
+// with https set go to the HTTPS workers first and so imply an HTTP
+// check as well; the rest are only checked over HTTP.
+type probeTarget struct {
+	https bool
+	port  string
+}
+
+// parseProbes turns the values given to -p into a list of targets,
+// expanding port templates and ranges (e.g. http:8000-8100)
+func parseProbes(probes []string) ([]probeTarget, error) {
+	var targets []probeTarget
+
+	for _, p := range probes {
+		if ports, ok := portTemplates[p]; ok {
+			for _, port := range ports {
+				targets = append(targets, probeTarget{https: true, port: port})
+			}
+			continue
+		}
+
+		pair := strings.SplitN(p, ":", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid probe %q: expected proto:port or a template name", p)
+		}
+
+		// This is a little bit funny as "https" will imply an
+		// http check as well unless the --prefer-https flag is
+		// set. On balance I don't think that's *such* a bad thing
+		// but it is maybe a little unexpected.
+		https := strings.ToLower(pair[0]) == "https"
+
+		low, high, err := parsePortRange(pair[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe %q: %s", p, err)
+		}
+
+		for port := low; port <= high; port++ {
+			targets = append(targets, probeTarget{https: https, port: strconv.Itoa(port)})
+		}
+	}
+
+	return targets, nil
+}
+
+// parsePortLines turns the lines of a -ports-file into targets. Each
+// line can be anything -p accepts, or just a port or range, which is
+// treated like the ports in a template. Lines that can't be parsed
+// are skipped, with an error for each returned in bad.
+func parsePortLines(lines []string) (targets []probeTarget, bad []error) {
+	for _, line := range lines {
+		if _, ok := portTemplates[line]; ok || strings.Contains(line, ":") {
+			t, err := parseProbes([]string{line})
+			if err != nil {
+				bad = append(bad, err)
+				continue
+			}
+			targets = append(targets, t...)
+			continue
+		}
+
+		low, high, err := parsePortRange(line)
+		if err != nil {
+			bad = append(bad, err)
+			continue
+		}
+		for port := low; port <= high; port++ {
+			targets = append(targets, probeTarget{https: true, port: strconv.Itoa(port)})
+		}
+	}
+	return targets, bad
+}
+
+// parsePortRange parses either a single port or a low-high range
+func parsePortRange(s string) (int, int, error) {
+	lowStr, highStr := s, s
+	if i := strings.Index(s, "-"); i != -1 {
+		lowStr, highStr = s[:i], s[i+1:]
+	}
+
+	low, err := parsePort(lowStr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	high, err := parsePort(highStr)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if low > high {
+		return 0, 0, fmt.Errorf("port range %d-%d is backwards", low, high)
+	}
+
+	return low, high, nil
+}
+
+// parsePort parses a port number, checking it's in the valid range
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// schemeKey is the context key used to pass the scheme of a request
+// down to the dialer
+type schemeKey struct{}
+
+// schemeRecorder is an http.RoundTripper that records the scheme of
+// each request in its context so that the dialer can route SOCKS5
+// connections by scheme
+type schemeRecorder struct {
+	http.RoundTripper
+}
+
+func (s schemeRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), schemeKey{}, req.URL.Scheme)
+	return s.RoundTripper.RoundTrip(req.WithContext(ctx))
+}
+
+// parseProxy parses a proxy URL as given to one of the proxy flags.
+// An empty string or "direct" means no proxy and returns nil.
+func parseProxy(raw string) (*url.URL, error) {
+	if raw == "" || raw == "direct" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+// isSOCKS5 reports whether a proxy URL is a SOCKS5 proxy. Hostnames
+// are always passed to SOCKS5 proxies to resolve, so socks5h:// is
+// handled the same as socks5://.
+func isSOCKS5(u *url.URL) bool {
+	return u != nil && (u.Scheme == "socks5" || u.Scheme == "socks5h")
+}
+
+// usesSOCKS5 reports whether any of the routes is a SOCKS5 proxy
+func usesSOCKS5(routes map[string]*url.URL) bool {
+	for _, u := range routes {
+		if isSOCKS5(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesHTTPProxy reports whether any of the routes is an HTTP or HTTPS
+// proxy
+func usesHTTPProxy(routes map[string]*url.URL) bool {
+	for _, u := range routes {
+		if u != nil && (u.Scheme == "http" || u.Scheme == "https") {
+			return true
+		}
+	}
+	return false
+}
+
+// configureProxies sets up a transport so that requests for each
+// scheme in routes go through the given proxy. HTTP proxies are set
+// with the transport's Proxy function; SOCKS5 proxies need a dialer,
+// which is picked using the scheme recorded by schemeRecorder. If auth
+// is non-nil it's used for SOCKS5 proxies instead of any credentials
+// in the proxy URL.
+func configureProxies(tr *http.Transport, dialer proxy.Dialer, routes map[string]*url.URL, auth *proxy.Auth) error {
+	socks := make(map[string]dialFunc)
+
+	for scheme, u := range routes {
+		if !isSOCKS5(u) {
+			continue
+		}
+
+		var socksDialer proxy.Dialer
+		var err error
+		if auth != nil {
+			socksDialer, err = proxy.SOCKS5("tcp", u.Host, auth, dialer)
+		} else {
+			socksDialer, err = proxy.FromURL(u, dialer)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create SOCKS5 dialer: %s", err)
+		}
+
+		if contextDialer, ok := socksDialer.(proxy.ContextDialer); ok {
+			socks[scheme] = contextDialer.DialContext
+		} else {
+			socks[scheme] = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return socksDialer.Dial(network, addr)
+			}
+		}
+	}
+
+	tr.Proxy = func(req *http.Request) (*url.URL, error) {
+		u := routes[req.URL.Scheme]
+		if u == nil || isSOCKS5(u) {
+			return nil, nil
+		}
+		return u, nil
+	}
+
+	if len(socks) > 0 {
+		direct := tr.DialContext
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			scheme, _ := ctx.Value(schemeKey{}).(string)
+			if dial, ok := socks[scheme]; ok {
+				return dial(ctx, network, addr)
+			}
+			return direct(ctx, network, addr)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+)
+
+var (
+	// metaRefreshTag matches a whole <meta http-equiv="refresh"> tag,
+	// and refreshURL the target in its content attribute
+	metaRefreshTag = regexp.MustCompile(`(?is)<meta[^>]*http-equiv\s*=\s*["']?refresh[^>]*>`)
+	refreshURL     = regexp.MustCompile(`(?i)url\s*=\s*['"]?([^'">\s;]+)`)
+
+	// jsLocation matches the common ways of redirecting from a script
+	jsLocation = regexp.MustCompile(`(?i)(?:window|document|self|top)\.location(?:\.href)?\s*=\s*["']([^"']+)["']|location\.(?:replace|assign)\(\s*["']([^"']+)["']`)
+)
+
+// findRefresh returns the target of a meta refresh or JavaScript
+// redirect in body, resolved against base. It returns an empty
+// string if there isn't one.
+func findRefresh(base *url.URL, body string) string {
+	var target string
+
+	if tag := metaRefreshTag.FindString(body); tag != "" {
+		if m := refreshURL.FindStringSubmatch(tag); m != nil {
+			target = m[1]
+		}
+	}
+
+	if target == "" {
+		if m := jsLocation.FindStringSubmatch(body); m != nil {
+			target = m[1]
+			if target == "" {
+				target = m[2]
+			}
+		}
+	}
+
+	if target == "" {
+		return ""
+	}
+
+	u, err := base.Parse(target)
+	if err != nil {
+		return target
+	}
+	return u.String()
+}
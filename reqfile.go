@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+)
+
+// requestTemplate is a raw HTTP request read with -request-file, which
+// is sent to every host in place of the usual request
+type requestTemplate struct {
+	method    string
+	path      string
+	userAgent string
+	headers   [][2]string
+	body      []byte
+}
+
+// templateSkipHeaders are the headers in a request file that are
+// ignored, because they're set for each request as it's sent
+var templateSkipHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+	"User-Agent":        true,
+}
+
+// loadRequestFile reads a raw HTTP request from a file. The Host header
+// and any host in the request line are dropped, as the request is sent
+// to each probed host in turn; the body is read according to the
+// Content-Length header.
+func loadRequestFile(filename string) (requestTemplate, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return requestTemplate{}, err
+	}
+	defer f.Close()
+
+	req, err := http.ReadRequest(bufio.NewReader(f))
+	if err != nil {
+		return requestTemplate{}, err
+	}
+	if req.Method == http.MethodConnect {
+		return requestTemplate{}, fmt.Errorf("CONNECT requests can't be used as a template")
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return requestTemplate{}, fmt.Errorf("failed to read body: %s", err)
+	}
+
+	t := requestTemplate{
+		method:    req.Method,
+		path:      req.URL.RequestURI(),
+		userAgent: req.Header.Get("User-Agent"),
+		body:      body,
+	}
+
+	// the order headers are sent in isn't kept by http.Header, so
+	// they're sorted to at least be consistent
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		if !templateSkipHeaders[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, val := range req.Header[name] {
+			t.headers = append(t.headers, [2]string{name, val})
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// loadResume reads a previous httprobe output file and returns the
+// set of hostnames that were found to be live. Plain, -json and -csv
+// output can be read. In plain output the first field of each line
+// must be a URL; lines marked [DEAD] or [not-live] (from -all) and
+// lines that don't start with a URL are ignored.
+func loadResume(filename string) (map[string]bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	seen := make(map[string]bool)
+	add := func(rawURL string) {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return
+		}
+		seen[strings.ToLower(u.Hostname())] = true
+	}
+
+	// the format is worked out from the start of the file
+	r := bufio.NewReader(f)
+	start, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(start, []byte("{")):
+		err = resumeJSON(r, add)
+	case bytes.Equal(start, []byte("url,")) || bytes.Equal(start, []byte("url\n")):
+		err = resumeCSV(r, add)
+	default:
+		err = resumeText(r, add)
+	}
+	return seen, err
+}
+
+// resumeText reads plain output, passing each live URL to add
+func resumeText(r io.Reader, add func(string)) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.Contains(sc.Text(), "[DEAD]") || strings.Contains(sc.Text(), "[not-live]") {
+			continue
+		}
+		add(fields[0])
+	}
+	return sc.Err()
+}
+
+// resumeJSON reads -json output, passing each live URL to add
+func resumeJSON(r io.Reader, add func(string)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var result struct {
+			URL  string `json:"url"`
+			Live bool   `json:"live"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &result); err != nil || !result.Live {
+			continue
+		}
+		add(result.URL)
+	}
+	return sc.Err()
+}
+
+// resumeCSV reads -csv output, passing each URL that isn't marked
+// with an error or as not live to add
+func resumeCSV(r io.Reader, add func(string)) error {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return err
+	}
+
+	urlCol, errCol, notLiveCol := -1, -1, -1
+	for i, name := range header {
+		switch name {
+		case "url":
+			urlCol = i
+		case "error":
+			errCol = i
+		case "notlive":
+			notLiveCol = i
+		}
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if errCol != -1 && record[errCol] != "" {
+			continue
+		}
+		if notLiveCol != -1 && record[notLiveCol] != "" {
+			continue
+		}
+		add(record[urlCol])
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRetryAfter is how long to wait before retrying a 429 or 503
+// response that didn't say how long to wait with Retry-After
+const defaultRetryAfter = time.Second
+
+// shouldRetry reports whether a response asks the client to come
+// back later, i.e. it's a 429 or 503
+func shouldRetry(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter returns how long a Retry-After header says to wait,
+// which can be given in seconds or as an HTTP date. Missing or invalid
+// values give defaultRetryAfter, and dates in the past give zero.
+func parseRetryAfter(val string, now time.Time) time.Duration {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return defaultRetryAfter
+	}
+
+	if secs, err := strconv.ParseInt(val, 10, 64); err == nil {
+		if secs < 0 {
+			return defaultRetryAfter
+		}
+		// avoid overflowing for absurdly large values, which are
+		// capped by -max-retry-after anyway
+		if secs > int64(24*time.Hour/time.Second) {
+			return 24 * time.Hour
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	t, err := http.ParseTime(val)
+	if err != nil {
+		return defaultRetryAfter
+	}
+	if wait := t.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
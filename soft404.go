@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// randomPath returns a path that's very unlikely to exist on any
+// host, used as the baseline for -soft404
+func randomPath() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "/" + hex.EncodeToString(b)
+}
+
+// isSoft404 reports whether a response looks the same as the
+// response to a path that doesn't exist, i.e. it has the same status
+// and an identical body
+func isSoft404(r, baseline probeResult) bool {
+	if !r.success || !baseline.success {
+		return false
+	}
+	if r.status != baseline.status {
+		return false
+	}
+	return r.bodyHash == baseline.bodyHash
+}
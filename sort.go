@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// sortKeys lists the values accepted by -sort
+var sortKeys = map[string]bool{
+	"url":    true,
+	"status": true,
+	"title":  true,
+}
+
+// sortOutputs sorts results by the given -sort key. Strings are
+// compared case-insensitively, and ties are broken by URL so that the
+// order is the same from run to run.
+func sortOutputs(outputs []probeOutput, by string) {
+	sort.SliceStable(outputs, func(i, j int) bool {
+		a, b := outputs[i], outputs[j]
+
+		switch by {
+		case "status":
+			if a.result.status != b.result.status {
+				return a.result.status < b.result.status
+			}
+		case "title":
+			at, bt := strings.ToLower(a.result.title), strings.ToLower(b.result.title)
+			if at != bt {
+				return at < bt
+			}
+		}
+
+		return strings.ToLower(a.url) < strings.ToLower(b.url)
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// runSummary counts what happened over a whole scan, for -summary
+type runSummary struct {
+	sync.Mutex
+
+	started time.Time
+	inputs  int
+	probes  int
+
+	// responses is the number of probes that got a response, which
+	// are counted by status class (e.g. "2xx"), and failures are
+	// counted by error class
+	responses int
+	statuses  map[string]int
+	failures  map[string]int
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{
+		started:  time.Now(),
+		statuses: make(map[string]int),
+		failures: make(map[string]int),
+	}
+}
+
+// input records an input line being read
+func (s *runSummary) input() {
+	s.Lock()
+	defer s.Unlock()
+	s.inputs++
+}
+
+// observe records the outcome of a single probe
+func (s *runSummary) observe(r probeResult) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.probes++
+	if r.success {
+		s.responses++
+		s.statuses[statusClass(r.status)]++
+	} else {
+		s.failures[classifyError(r.err)]++
+	}
+}
+
+// statusClass returns the class of a status code, e.g. "4xx"
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// jsonSummary is the structure of the -summary file
+type jsonSummary struct {
+	Started   time.Time      `json:"started"`
+	Finished  time.Time      `json:"finished"`
+	Elapsed   float64        `json:"elapsed_seconds"`
+	Inputs    int            `json:"inputs"`
+	Probes    int            `json:"probes"`
+	Responses int            `json:"responses"`
+	Live      int            `json:"live"`
+	Statuses  map[string]int `json:"status_classes"`
+	Failures  map[string]int `json:"error_classes"`
+}
+
+// write saves the summary to a file as JSON. live is the number of
+// live hosts that were output, after any filters.
+func (s *runSummary) write(filename string, live int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	finished := time.Now()
+	body, err := json.MarshalIndent(jsonSummary{
+		Started:   s.started,
+		Finished:  finished,
+		Elapsed:   finished.Sub(s.started).Seconds(),
+		Inputs:    s.inputs,
+		Probes:    s.probes,
+		Responses: s.responses,
+		Live:      live,
+		Statuses:  s.statuses,
+		Failures:  s.failures,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append(body, '\n'), 0644)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+)
+
+// techSignature identifies a technology from a response header. If
+// match is nil the header just has to be present.
+type techSignature struct {
+	name   string
+	header string
+	match  *regexp.Regexp
+}
+
+// techSignatures is the table used by -tech. To detect something new,
+// add a signature here.
+var techSignatures = []techSignature{
+	// CDNs and WAFs
+	{"Cloudflare", "Cf-Ray", nil},
+	{"Cloudflare", "Server", regexp.MustCompile(`(?i)cloudflare`)},
+	{"CloudFront", "X-Amz-Cf-Id", nil},
+	{"Akamai", "X-Akamai-Transformed", nil},
+	{"Akamai", "Server", regexp.MustCompile(`(?i)akamaighost`)},
+	{"Fastly", "X-Fastly-Request-Id", nil},
+	{"Fastly", "X-Served-By", regexp.MustCompile(`^cache-`)},
+	{"Varnish", "X-Varnish", nil},
+	{"Sucuri", "X-Sucuri-Id", nil},
+	{"Imperva", "X-Iinfo", nil},
+	{"Imperva", "Set-Cookie", regexp.MustCompile(`^(incap_ses|visid_incap)_`)},
+	{"AWS ELB", "Set-Cookie", regexp.MustCompile(`^AWSALB`)},
+	{"Vercel", "X-Vercel-Id", nil},
+	{"Netlify", "X-Nf-Request-Id", nil},
+
+	// servers
+	{"nginx", "Server", regexp.MustCompile(`(?i)nginx`)},
+	{"Apache", "Server", regexp.MustCompile(`(?i)apache`)},
+	{"IIS", "Server", regexp.MustCompile(`(?i)microsoft-iis`)},
+	{"Envoy", "Server", regexp.MustCompile(`(?i)envoy`)},
+	{"Envoy", "X-Envoy-Upstream-Service-Time", nil},
+
+	// languages and frameworks
+	{"PHP", "X-Powered-By", regexp.MustCompile(`(?i)php`)},
+	{"PHP", "Set-Cookie", regexp.MustCompile(`^PHPSESSID=`)},
+	{"ASP.NET", "X-Powered-By", regexp.MustCompile(`(?i)asp\.net`)},
+	{"ASP.NET", "X-AspNet-Version", nil},
+	{"ASP.NET", "Set-Cookie", regexp.MustCompile(`^ASP\.NET_SessionId=`)},
+	{"Express", "X-Powered-By", regexp.MustCompile(`(?i)express`)},
+	{"Java", "Set-Cookie", regexp.MustCompile(`^JSESSIONID=`)},
+	{"Laravel", "Set-Cookie", regexp.MustCompile(`^laravel_session=`)},
+	{"Django", "Set-Cookie", regexp.MustCompile(`^csrftoken=`)},
+}
+
+// detectTech returns the names of the technologies whose signatures
+// match the headers, in signature table order and without duplicates
+func detectTech(h http.Header) []string {
+	var found []string
+	seen := make(map[string]bool)
+
+	for _, sig := range techSignatures {
+		if seen[sig.name] {
+			continue
+		}
+
+		values := h.Values(sig.header)
+		if len(values) == 0 {
+			continue
+		}
+
+		matched := sig.match == nil
+		for _, v := range values {
+			if matched {
+				break
+			}
+			matched = sig.match.MatchString(v)
+		}
+
+		if matched {
+			found = append(found, sig.name)
+			seen[sig.name] = true
+		}
+	}
+
+	return found
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDetectTech(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string][]string
+		want    []string
+	}{
+		{
+			name: "nothing",
+			headers: map[string][]string{
+				"Content-Type": {"text/html"},
+			},
+			want: nil,
+		},
+		{
+			name: "present header",
+			headers: map[string][]string{
+				"Cf-Ray": {"8a1b2c3d4e5f-LHR"},
+			},
+			want: []string{"Cloudflare"},
+		},
+		{
+			name: "server match is case-insensitive",
+			headers: map[string][]string{
+				"Server": {"NGINX/1.25.3"},
+			},
+			want: []string{"nginx"},
+		},
+		{
+			name: "server doesn't match",
+			headers: map[string][]string{
+				"Server": {"lighttpd"},
+			},
+			want: nil,
+		},
+		{
+			name: "one of several cookies",
+			headers: map[string][]string{
+				"Set-Cookie": {"theme=dark", "PHPSESSID=abc123; path=/"},
+			},
+			want: []string{"PHP"},
+		},
+		{
+			name: "cookie must be at the start",
+			headers: map[string][]string{
+				"Set-Cookie": {"foo=JSESSIONID="},
+			},
+			want: nil,
+		},
+		{
+			name: "duplicates are dropped",
+			headers: map[string][]string{
+				"Cf-Ray": {"8a1b2c3d4e5f-LHR"},
+				"Server": {"cloudflare"},
+			},
+			want: []string{"Cloudflare"},
+		},
+		{
+			name: "table order",
+			headers: map[string][]string{
+				"X-Powered-By": {"Express"},
+				"Server":       {"nginx"},
+				"X-Amz-Cf-Id":  {"abc"},
+			},
+			want: []string{"CloudFront", "nginx", "Express"},
+		},
+	}
+
+	for _, tt := range tests {
+		h := make(http.Header)
+		for name, values := range tt.headers {
+			for _, v := range values {
+				h.Add(name, v)
+			}
+		}
+
+		if got := detectTech(h); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: detectTech() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// probeTiming is a breakdown of where the time went in a request
+type probeTiming struct {
+	dns     time.Duration
+	connect time.Duration
+	tls     time.Duration
+
+	// ttfb is the time from the request being sent to the first
+	// byte of the response arriving
+	ttfb time.Duration
+}
+
+func (t probeTiming) String() string {
+	return fmt.Sprintf(
+		"dns:%s connect:%s tls:%s ttfb:%s",
+		t.dns.Round(time.Millisecond),
+		t.connect.Round(time.Millisecond),
+		t.tls.Round(time.Millisecond),
+		t.ttfb.Round(time.Millisecond),
+	)
+}
+
+// timingRecorder collects the timings for a request from an
+// httptrace.ClientTrace. Only the first of each event is recorded, so
+// followed redirects don't overwrite the timings for the original URL.
+// Dials can finish after the request has been made (e.g. when racing
+// IPv4 and IPv6), so access is guarded by a mutex.
+type timingRecorder struct {
+	sync.Mutex
+
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+}
+
+// setOnce sets t to the current time if it hasn't already been set
+func (r *timingRecorder) setOnce(t *time.Time) {
+	r.Lock()
+	defer r.Unlock()
+	if t.IsZero() {
+		*t = time.Now()
+	}
+}
+
+// hook adds the timing callbacks to a trace
+func (r *timingRecorder) hook(trace *httptrace.ClientTrace) {
+	trace.DNSStart = func(httptrace.DNSStartInfo) { r.setOnce(&r.dnsStart) }
+	trace.DNSDone = func(httptrace.DNSDoneInfo) { r.setOnce(&r.dnsDone) }
+	trace.ConnectStart = func(string, string) { r.setOnce(&r.connectStart) }
+	trace.ConnectDone = func(_, _ string, err error) {
+		if err == nil {
+			r.setOnce(&r.connectDone)
+		}
+	}
+	trace.TLSHandshakeStart = func() { r.setOnce(&r.tlsStart) }
+	trace.TLSHandshakeDone = func(tls.ConnectionState, error) { r.setOnce(&r.tlsDone) }
+	trace.WroteRequest = func(httptrace.WroteRequestInfo) { r.setOnce(&r.wroteRequest) }
+	trace.GotFirstResponseByte = func() { r.setOnce(&r.firstByte) }
+}
+
+// timing returns the durations recorded so far
+func (r *timingRecorder) timing() probeTiming {
+	r.Lock()
+	defer r.Unlock()
+
+	return probeTiming{
+		dns:     between(r.dnsStart, r.dnsDone),
+		connect: between(r.connectStart, r.connectDone),
+		tls:     between(r.tlsStart, r.tlsDone),
+		ttfb:    between(r.wroteRequest, r.firstByte),
+	}
+}
+
+// between returns the time from start to end, or zero if either
+// of them didn't happen
+func between(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
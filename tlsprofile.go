@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+// tlsProfiles maps the values accepted by -tls-profile to the browser
+// ClientHellos they mimic
+var tlsProfiles = map[string]utls.ClientHelloID{
+	"chrome":     utls.HelloChrome_Auto,
+	"firefox":    utls.HelloFirefox_Auto,
+	"safari":     utls.HelloSafari_Auto,
+	"edge":       utls.HelloEdge_Auto,
+	"ios":        utls.HelloIOS_Auto,
+	"android":    utls.HelloAndroid_11_OkHttp,
+	"randomized": utls.HelloRandomizedNoALPN,
+}
+
+// tlsProfileNames returns the names of the TLS profiles for use in
+// error messages
+func tlsProfileNames() string {
+	names := make([]string, 0, len(tlsProfiles))
+	for name := range tlsProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// profileDialer returns a DialTLSContext function that makes TLS
+// connections with a ClientHello that mimics the given browser. The
+// relevant settings are copied over from base.
+//
+// The transport only speaks HTTP/2 over a *tls.Conn, so ALPN is
+// limited to HTTP/1.1. The transport doesn't report the TLS state of
+// other connections either, so it's passed to the trace's
+// TLSHandshakeDone hook instead.
+func profileDialer(dial dialFunc, id utls.ClientHelloID, base *tls.Config) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+
+		cfg := &utls.Config{
+			ServerName:         base.ServerName,
+			InsecureSkipVerify: base.InsecureSkipVerify,
+			MinVersion:         base.MinVersion,
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = host
+		}
+		for _, c := range base.Certificates {
+			cfg.Certificates = append(cfg.Certificates, utls.Certificate{
+				Certificate: c.Certificate,
+				PrivateKey:  c.PrivateKey,
+				Leaf:        c.Leaf,
+			})
+		}
+
+		var uconn *utls.UConn
+		if id == utls.HelloRandomizedNoALPN {
+			uconn = utls.UClient(conn, cfg, id)
+		} else {
+			spec, err := utls.UTLSIdToSpec(id)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			for _, ext := range spec.Extensions {
+				if alpn, ok := ext.(*utls.ALPNExtension); ok {
+					alpn.AlpnProtocols = []string{"http/1.1"}
+				}
+			}
+
+			uconn = utls.UClient(conn, cfg, utls.HelloCustom)
+			if err := uconn.ApplyPreset(&spec); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+
+		trace := httptrace.ContextClientTrace(ctx)
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
+
+		err = uconn.HandshakeContext(ctx)
+
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			cs := uconn.ConnectionState()
+			trace.TLSHandshakeDone(tls.ConnectionState{
+				Version:            cs.Version,
+				HandshakeComplete:  cs.HandshakeComplete,
+				CipherSuite:        cs.CipherSuite,
+				NegotiatedProtocol: cs.NegotiatedProtocol,
+				ServerName:         cs.ServerName,
+				PeerCertificates:   cs.PeerCertificates,
+				VerifiedChains:     cs.VerifiedChains,
+			}, err)
+		}
+
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return uconn, nil
+	}
+}
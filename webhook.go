@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// webhook POSTs results to a URL in the background. Results are
+// queued and sent by a small pool of workers, so a slow endpoint
+// doesn't hold up the scan; if the queue fills up, further results are
+// dropped rather than waited for.
+type webhook struct {
+	url    string
+	client *http.Client
+	queue  chan []byte
+	wg     sync.WaitGroup
+
+	// ctx is cancelled to abandon whatever hasn't been sent yet
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// warn prints a warning, and unsent counts the results that were
+	// dropped or abandoned
+	warn        func(format string, args ...any)
+	fullWarning sync.Once
+	unsent      atomic.Int64
+}
+
+const (
+	webhookWorkers  = 4
+	webhookQueue    = 1024
+	webhookAttempts = 3
+
+	// webhookDrain is the longest to wait for queued results to be
+	// sent once the scan has finished
+	webhookDrain = 30 * time.Second
+)
+
+// newWebhook checks the URL and starts the workers for a webhook
+func newWebhook(rawURL string, warn func(format string, args ...any)) (*webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("must be an http:// or https:// URL")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &webhook{
+		url:    rawURL,
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan []byte, webhookQueue),
+		ctx:    ctx,
+		cancel: cancel,
+		warn:   warn,
+	}
+
+	for i := 0; i < webhookWorkers; i++ {
+		w.wg.Add(1)
+		go func() {
+			for body := range w.queue {
+				if w.ctx.Err() != nil {
+					w.unsent.Add(1)
+					continue
+				}
+				if err := w.post(body); err != nil {
+					if w.ctx.Err() != nil {
+						w.unsent.Add(1)
+						continue
+					}
+					fmt.Fprintf(os.Stderr, "failed to send result to webhook: %s\n", err)
+				}
+			}
+			w.wg.Done()
+		}()
+	}
+
+	return w, nil
+}
+
+// send queues a JSON body to be posted, dropping it if the queue is
+// full so that a slow endpoint can't hold up the scan
+func (w *webhook) send(body []byte) {
+	select {
+	case w.queue <- body:
+	default:
+		w.unsent.Add(1)
+		w.fullWarning.Do(func() {
+			w.warn("Warning: webhook queue is full, dropping results")
+		})
+	}
+}
+
+// post sends a body to the webhook, retrying with a backoff if it
+// fails or the server responds with a 429 or 5xx status
+func (w *webhook) post(body []byte) error {
+	var err error
+	for attempt := 0; attempt < webhookAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-w.ctx.Done():
+				return w.ctx.Err()
+			}
+		}
+
+		var req *http.Request
+		req, err = http.NewRequestWithContext(w.ctx, http.MethodPost, w.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		var resp *http.Response
+		resp, err = w.client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			err = fmt.Errorf("webhook responded with %s", resp.Status)
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("webhook responded with %s", resp.Status)
+		}
+		return nil
+	}
+	return err
+}
+
+// Close waits for the queued results to be sent, giving up on any
+// that are left after webhookDrain or once ctx is done
+func (w *webhook) Close(ctx context.Context) {
+	close(w.queue)
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(webhookDrain)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	w.cancel()
+	<-done
+
+	if n := w.unsent.Load(); n > 0 {
+		w.warn("Warning: %d result(s) weren't sent to the webhook", n)
+	}
+}